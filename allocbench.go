@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// The -allocs flag plays a fresh game through each state for a while and logs
+// how much it allocates per frame there, to catch Update or Draw code that
+// makes garbage every frame. Counts include whatever ebiten allocates between
+// frames.
+
+const (
+	allocWarmupFrames = 30  // Let caches fill before measuring
+	allocFrames       = 300 // Frames measured in each state
+)
+
+// allocPhase is a game state to measure, with anything needed to keep the
+// game in it
+type allocPhase struct {
+	name  string
+	state GameState
+	start func(g *Game) error // Called once before the phase, may be nil
+	frame func(g *Game)       // Called before every frame, may be nil
+}
+
+var allocPhases = []allocPhase{
+	{name: "menu", state: MenuState},
+	{name: "play", state: PlayState},
+	{name: "play, talking", state: PlayState, start: openAllocDialogue},
+	{name: "time stopped", state: TimeStopped},
+	// Half faded, so the fades never finish and change the scene
+	{name: "transition", state: TransitionState, frame: halfFaded},
+	{name: "new scene", state: NewSceneState, frame: halfFaded},
+	{name: "cutscene", state: CutsceneState, start: startFirstCutscene},
+}
+
+func openAllocDialogue(g *Game) error {
+	g.dialogue.Open(g, LinesTree("player", []string{"Measuring how much the dialogue box allocates while it types this line out."}))
+	return nil
+}
+
+func halfFaded(g *Game) {
+	g.alpha = 0.5
+}
+
+func startFirstCutscene(g *Game) error {
+	if len(g.cutscenes) == 0 {
+		return fmt.Errorf("no cutscenes")
+	}
+	return g.StartCutscene(g.cutscenes[0].Name)
+}
+
+// allocBench runs the game through allocPhases
+type allocBench struct {
+	*Game
+	phase     int
+	frames    int
+	cutscenes []*CutsceneScript // Put aside so they don't start by themselves
+	before    runtime.MemStats
+	results   []string
+}
+
+func newAllocBench(g *Game) *allocBench {
+	b := &allocBench{Game: g, cutscenes: g.cutscenes}
+	g.cutscenes = nil
+	return b
+}
+
+func (b *allocBench) Update() error {
+	if b.phase == len(allocPhases) {
+		for _, r := range b.results {
+			log.Println(r)
+		}
+		return ebiten.Termination
+	}
+	p := allocPhases[b.phase]
+	if b.frames == 0 {
+		b.dialogue = newDialogue()
+		b.state = p.state
+		if p.state == CutsceneState {
+			b.Game.cutscenes = b.cutscenes
+		}
+		if p.start != nil {
+			if err := p.start(b.Game); err != nil {
+				b.results = append(b.results, fmt.Sprintf("%-14s skipped: %v", p.name, err))
+				b.next()
+				return nil
+			}
+		}
+	}
+	// Cutscenes end by themselves, everything else is held in its state
+	if p.state == CutsceneState && b.state != CutsceneState {
+		b.record(p)
+		return nil
+	}
+	b.state = p.state
+	if p.frame != nil {
+		p.frame(b.Game)
+	}
+	if b.frames == allocWarmupFrames {
+		runtime.ReadMemStats(&b.before)
+	}
+	if b.frames == allocWarmupFrames+allocFrames {
+		b.record(p)
+		return nil
+	}
+	b.frames++
+	return b.Game.Update()
+}
+
+// record logs the allocations of the phase so far and moves on to the next
+func (b *allocBench) record(p allocPhase) {
+	measured := b.frames - allocWarmupFrames
+	if measured <= 0 {
+		b.results = append(b.results, fmt.Sprintf("%-14s ended before it could be measured", p.name))
+		b.next()
+		return
+	}
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+	b.results = append(b.results, fmt.Sprintf("%-14s %8.1f allocs/frame %10.1f bytes/frame over %d frames",
+		p.name,
+		float64(after.Mallocs-b.before.Mallocs)/float64(measured),
+		float64(after.TotalAlloc-b.before.TotalAlloc)/float64(measured),
+		measured))
+	b.next()
+}
+
+func (b *allocBench) next() {
+	b.phase++
+	b.frames = 0
+	b.Game.cutscenes = nil
+}
@@ -0,0 +1,350 @@
+// Package anim plays named animation clips cut from sprite sheets. An
+// Animation is the shared description of a character's clips, loaded from a
+// descriptor file, and each character has its own Animator playing them:
+//
+//	{
+//	  "frameWidth": 48, "frameHeight": 68,
+//	  "skins": ["default", "Black"],
+//	  "sheets": {"down": "assets/playerDown{skin}.png", "left": "assets/playerLeft{skin}.png", ...},
+//	  "mirror": {"left": "right"},
+//	  "clips": {
+//	    "walk_down": {"sheet": "down", "frames": [0, 1, 2, 3], "duration": 10, "events": {"1": "step"}},
+//	    "wave": {"sheet": "down", "frames": [4, 5], "durations": [8, 20], "once": true},
+//	    ...
+//	  }
+//	}
+//
+// Frames are numbered left to right, top to bottom. Clips that depend on
+// which way the character faces are named <clip>_<direction>.
+//
+// A sheet in "mirror" that has no file, or no path at all, is the other sheet
+// flipped, so a character only needs left facing art if it isn't symmetrical.
+// {skin} in a path is replaced by the skin being loaded, with the default skin
+// leaving it empty.
+package anim
+
+import (
+	"ebi/camera"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+type Mode int
+
+const (
+	Loop Mode = iota // Start over after the last frame
+	Once             // Stay on the last frame
+)
+
+// DefaultSkin is the skin whose files have nothing in place of {skin}
+const DefaultSkin = "default"
+
+// SkinPath fills in the skin in a path, e.g. "Black" in
+// "assets/playerDown{skin}.png"
+func SkinPath(path, skin string) string {
+	if skin == DefaultSkin {
+		skin = ""
+	}
+	return strings.ReplaceAll(path, "{skin}", skin)
+}
+
+// Clip is a run of frames from one sheet
+type Clip struct {
+	Name      string
+	Sheet     *ebiten.Image
+	Frames    []int
+	Durations []int // Ticks each frame is shown for
+	Mode      Mode
+	FlipX     bool           // Mirrored, e.g. to face left using the right facing frames
+	Events    map[int]string // Fired when the frame at that index into Frames comes up
+}
+
+// Animation holds every clip a character has
+type Animation struct {
+	FrameWidth, FrameHeight int
+	Skin                    string
+	Clips                   map[string]*Clip
+}
+
+type descriptor struct {
+	FrameWidth  int                       `json:"frameWidth"`
+	FrameHeight int                       `json:"frameHeight"`
+	Skins       []string                  `json:"skins"` // Any skin goes if empty
+	Sheets      map[string]string         `json:"sheets"`
+	Mirror      map[string]string         `json:"mirror"` // Sheet to flip when one has no art
+	Clips       map[string]clipDescriptor `json:"clips"`
+}
+
+type clipDescriptor struct {
+	Sheet     string            `json:"sheet"`
+	Frames    []int             `json:"frames"`
+	Duration  int               `json:"duration"`  // Ticks for every frame
+	Durations []int             `json:"durations"` // Or ticks for each frame
+	Once      bool              `json:"once"`
+	FlipX     bool              `json:"flipX"`
+	Events    map[string]string `json:"events"`
+}
+
+// Load reads a descriptor for one skin, using load to get the sheet images
+func Load(data []byte, skin string, load func(path string) (*ebiten.Image, error)) (*Animation, error) {
+	var d descriptor
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, err
+	}
+	if d.FrameWidth <= 0 || d.FrameHeight <= 0 {
+		return nil, fmt.Errorf("frameWidth and frameHeight must be positive")
+	}
+	if skin == "" {
+		skin = DefaultSkin
+	}
+	if len(d.Skins) > 0 && !contains(d.Skins, skin) {
+		return nil, fmt.Errorf("no skin %q, there is %s", skin, strings.Join(d.Skins, ", "))
+	}
+	sheets, mirrored, err := d.loadSheets(skin, load)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Animation{FrameWidth: d.FrameWidth, FrameHeight: d.FrameHeight, Skin: skin, Clips: make(map[string]*Clip)}
+	names := make([]string, 0, len(d.Clips))
+	for name := range d.Clips {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cd := d.Clips[name]
+		c, err := a.clip(name, cd, sheets[cd.Sheet])
+		if err != nil {
+			return nil, fmt.Errorf("clip %s: %v", name, err)
+		}
+		// Flipping a mirrored sheet again shows it the way it was drawn
+		c.FlipX = c.FlipX != mirrored[cd.Sheet]
+		a.Clips[name] = c
+	}
+	return a, nil
+}
+
+// loadSheets loads the sheets with their own art, then fills in the mirrored
+// ones that don't have any. It also returns which sheets are mirrored.
+func (d *descriptor) loadSheets(skin string, load func(path string) (*ebiten.Image, error)) (map[string]*ebiten.Image, map[string]bool, error) {
+	sheets := make(map[string]*ebiten.Image)
+	mirrored := make(map[string]bool)
+	for name, path := range d.Sheets {
+		img, err := load(SkinPath(path, skin))
+		if errors.Is(err, fs.ErrNotExist) && d.Mirror[name] != "" {
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("sheet %s: %v", name, err)
+		}
+		sheets[name] = img
+	}
+	for name, from := range d.Mirror {
+		if _, ok := sheets[name]; ok || mirrored[name] {
+			continue
+		}
+		// Only sheets with their own art can be mirrored
+		if _, ok := sheets[from]; !ok || mirrored[from] {
+			return nil, nil, fmt.Errorf("sheet %s mirrors %s, which has no art", name, from)
+		}
+		sheets[name] = sheets[from]
+		mirrored[name] = true
+	}
+	return sheets, mirrored, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *Animation) clip(name string, cd clipDescriptor, sheet *ebiten.Image) (*Clip, error) {
+	if sheet == nil {
+		return nil, fmt.Errorf("unknown sheet %q", cd.Sheet)
+	}
+	if len(cd.Frames) == 0 {
+		return nil, fmt.Errorf("no frames")
+	}
+	count := (sheet.Bounds().Dx() / a.FrameWidth) * (sheet.Bounds().Dy() / a.FrameHeight)
+	for _, f := range cd.Frames {
+		if f < 0 || f >= count {
+			return nil, fmt.Errorf("frame %d is not on the sheet, which has %d", f, count)
+		}
+	}
+
+	c := &Clip{Name: name, Sheet: sheet, Frames: cd.Frames, FlipX: cd.FlipX, Events: make(map[int]string)}
+	switch {
+	case cd.Durations != nil:
+		if len(cd.Durations) != len(cd.Frames) {
+			return nil, fmt.Errorf("%d durations for %d frames", len(cd.Durations), len(cd.Frames))
+		}
+		c.Durations = cd.Durations
+	case cd.Duration > 0:
+		c.Durations = make([]int, len(cd.Frames))
+		for i := range c.Durations {
+			c.Durations[i] = cd.Duration
+		}
+	default:
+		return nil, fmt.Errorf("needs a duration")
+	}
+	for _, d := range c.Durations {
+		if d <= 0 {
+			return nil, fmt.Errorf("durations must be positive")
+		}
+	}
+	if cd.Once {
+		c.Mode = Once
+	}
+	for at, event := range cd.Events {
+		i, err := strconv.Atoi(at)
+		if err != nil || i < 0 || i >= len(c.Frames) {
+			return nil, fmt.Errorf("event %q is on frame %q, which the clip doesn't have", event, at)
+		}
+		c.Events[i] = event
+	}
+	return c, nil
+}
+
+// Animator plays one clip of an animation at a time
+type Animator struct {
+	Animation *Animation
+	OnEvent   func(event string) // Called for clip events, may be nil
+	clip      *Clip
+	frame     int // Index into clip.Frames
+	ticks     int // Ticks the frame has been shown for
+}
+
+func NewAnimator(a *Animation, clip string) *Animator {
+	an := &Animator{Animation: a}
+	an.Play(clip)
+	return an
+}
+
+// Play switches to a clip from its first frame. Asking for the clip that is
+// already playing carries on with it, so it can be called every tick.
+// Unknown clips are ignored.
+func (an *Animator) Play(name string) {
+	if an.clip != nil && an.clip.Name == name {
+		return
+	}
+	c, ok := an.Animation.Clips[name]
+	if !ok {
+		return
+	}
+	an.clip, an.frame, an.ticks = c, 0, 0
+	an.fire()
+}
+
+// PlayDir plays the version of a clip for a direction, e.g. walk_left
+func (an *Animator) PlayDir(name, dir string) {
+	an.Play(name + "_" + dir)
+}
+
+// Restart plays a clip from its first frame even if it is already playing
+func (an *Animator) Restart(name string) {
+	an.clip = nil
+	an.Play(name)
+}
+
+// Clip returns the name of the clip playing
+func (an *Animator) Clip() string {
+	if an.clip == nil {
+		return ""
+	}
+	return an.clip.Name
+}
+
+// Done reports whether a clip that plays once has reached its last frame
+func (an *Animator) Done() bool {
+	return an.clip != nil && an.clip.Mode == Once && an.frame == len(an.clip.Frames)-1 &&
+		an.ticks >= an.clip.Durations[an.frame]
+}
+
+// Update advances the clip by one tick
+func (an *Animator) Update() {
+	c := an.clip
+	if c == nil {
+		return
+	}
+	an.ticks++
+	if an.ticks < c.Durations[an.frame] {
+		return
+	}
+	if an.frame == len(c.Frames)-1 {
+		if c.Mode == Once {
+			return
+		}
+		an.frame = 0
+	} else {
+		an.frame++
+	}
+	an.ticks = 0
+	an.fire()
+}
+
+func (an *Animator) fire() {
+	if event, ok := an.clip.Events[an.frame]; ok && an.OnEvent != nil {
+		an.OnEvent(event)
+	}
+}
+
+// SetAnimation swaps in a new version of the animation, e.g. after its files
+// were reloaded, carrying on with the same clip
+func (an *Animator) SetAnimation(a *Animation) {
+	name, frame, ticks := an.Clip(), an.frame, an.ticks
+	an.Animation, an.clip = a, nil
+	an.Play(name)
+	if an.clip != nil && frame < len(an.clip.Frames) {
+		an.frame, an.ticks = frame, ticks
+	}
+}
+
+// Size returns the size of a frame
+func (an *Animator) Size() (int, int) {
+	return an.Animation.FrameWidth, an.Animation.FrameHeight
+}
+
+// Frame returns the image of the current frame and whether it is mirrored
+func (an *Animator) Frame() (*ebiten.Image, bool) {
+	c := an.clip
+	if c == nil {
+		return nil, false
+	}
+	w, h := an.Size()
+	f := c.Frames[an.frame]
+	cols := c.Sheet.Bounds().Dx() / w
+	x, y := f%cols*w, f/cols*h
+	return c.Sheet.SubImage(image.Rect(x, y, x+w, y+h)).(*ebiten.Image), c.FlipX
+}
+
+// Draw draws the current frame with its top left at x, y in the world. opts
+// may carry colour changes, its GeoM is replaced.
+func (an *Animator) Draw(dst *ebiten.Image, x, y float64, cam *camera.Camera, opts *ebiten.DrawImageOptions) {
+	frame, flip := an.Frame()
+	if frame == nil {
+		return
+	}
+	if opts == nil {
+		opts = &ebiten.DrawImageOptions{}
+	}
+	opts.GeoM.Reset()
+	if flip {
+		opts.GeoM.Scale(-1, 1)
+		opts.GeoM.Translate(float64(an.Animation.FrameWidth), 0)
+	}
+	opts.GeoM.Translate(x, y)
+	cam.Apply(&opts.GeoM)
+	dst.DrawImage(frame, opts)
+}
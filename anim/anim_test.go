@@ -0,0 +1,232 @@
+package anim
+
+import (
+	"fmt"
+	"image"
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// sheets makes a loader for blank sheets of the given sizes, in frames of
+// 10x20, and records the paths asked for
+func sheets(sizes map[string]image.Point, asked *[]string) func(string) (*ebiten.Image, error) {
+	return func(path string) (*ebiten.Image, error) {
+		if asked != nil {
+			*asked = append(*asked, path)
+		}
+		size, ok := sizes[path]
+		if !ok {
+			return nil, fmt.Errorf("open %s: %w", path, fs.ErrNotExist)
+		}
+		return ebiten.NewImage(size.X*10, size.Y*20), nil
+	}
+}
+
+const walker = `{
+	"frameWidth": 10, "frameHeight": 20,
+	"sheets": {"down": "down.png"},
+	"clips": {
+		"walk_down": {"sheet": "down", "frames": [0, 1, 2, 3], "duration": 5, "events": {"1": "step", "3": "step"}},
+		"wave": {"sheet": "down", "frames": [4, 5], "durations": [2, 3], "once": true}
+	}
+}`
+
+func loadWalker(t *testing.T) *Animation {
+	t.Helper()
+	a, err := Load([]byte(walker), "", sheets(map[string]image.Point{"down.png": {3, 2}}, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestLoad(t *testing.T) {
+	a := loadWalker(t)
+	if a.FrameWidth != 10 || a.FrameHeight != 20 || a.Skin != DefaultSkin {
+		t.Errorf("loaded %+v", a)
+	}
+	walk := a.Clips["walk_down"]
+	if walk.Mode != Loop || !reflect.DeepEqual(walk.Durations, []int{5, 5, 5, 5}) || !reflect.DeepEqual(walk.Events, map[int]string{1: "step", 3: "step"}) {
+		t.Errorf("walk_down is %+v", walk)
+	}
+	wave := a.Clips["wave"]
+	if wave.Mode != Once || !reflect.DeepEqual(wave.Durations, []int{2, 3}) {
+		t.Errorf("wave is %+v", wave)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	clip := func(c string) string {
+		return `{"frameWidth": 10, "frameHeight": 20, "sheets": {"down": "down.png"}, "clips": {"c": ` + c + `}}`
+	}
+	tests := []struct {
+		data, err string
+	}{
+		{`{"frameWidth": 10}`, "frameWidth and frameHeight must be positive"},
+		{`{"frameWidth": 10, "frameHeight": 20, "sheets": {"up": "up.png"}}`, "sheet up: open up.png"},
+		{clip(`{"sheet": "up", "frames": [0], "duration": 1}`), `clip c: unknown sheet "up"`},
+		{clip(`{"sheet": "down", "frames": [], "duration": 1}`), "clip c: no frames"},
+		{clip(`{"sheet": "down", "frames": [6], "duration": 1}`), "clip c: frame 6 is not on the sheet, which has 6"},
+		{clip(`{"sheet": "down", "frames": [0, 1]}`), "clip c: needs a duration"},
+		{clip(`{"sheet": "down", "frames": [0, 1], "durations": [1]}`), "clip c: 1 durations for 2 frames"},
+		{clip(`{"sheet": "down", "frames": [0, 1], "durations": [1, 0]}`), "clip c: durations must be positive"},
+		{clip(`{"sheet": "down", "frames": [0, 1], "duration": 1, "events": {"2": "step"}}`), `clip c: event "step" is on frame "2"`},
+		{`{"frameWidth": 10,`, "unexpected end of JSON input"},
+	}
+	load := sheets(map[string]image.Point{"down.png": {3, 2}}, nil)
+	for _, tt := range tests {
+		_, err := Load([]byte(tt.data), "", load)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want %q", tt.data, err, tt.err)
+		}
+	}
+}
+
+func TestAnimator(t *testing.T) {
+	an := NewAnimator(loadWalker(t), "walk_down")
+	var events []string
+	an.OnEvent = func(e string) { events = append(events, e) }
+
+	var frames []int
+	for i := 0; i < 25; i++ {
+		frames = append(frames, an.frame)
+		an.Update()
+	}
+	// Five ticks a frame, round and round
+	want := []int{0, 0, 0, 0, 0, 1, 1, 1, 1, 1, 2, 2, 2, 2, 2, 3, 3, 3, 3, 3, 0, 0, 0, 0, 0}
+	if !reflect.DeepEqual(frames, want) {
+		t.Errorf("frames %v, want %v", frames, want)
+	}
+	// The last tick moved on to frame 1
+	if !reflect.DeepEqual(events, []string{"step", "step", "step"}) {
+		t.Errorf("events %q", events)
+	}
+
+	// Asking for the same clip carries on, Restart starts over
+	an.Play("walk_down")
+	if an.frame != 1 {
+		t.Errorf("Play restarted the clip")
+	}
+	an.Restart("walk_down")
+	if an.frame != 0 || an.ticks != 0 {
+		t.Errorf("Restart left it on frame %d tick %d", an.frame, an.ticks)
+	}
+	an.Play("dance")
+	if an.Clip() != "walk_down" {
+		t.Errorf("unknown clip replaced %q", "walk_down")
+	}
+
+	// A clip played once stops on its last frame
+	an.Play("wave")
+	for i := 0; i < 4; i++ {
+		if an.Done() {
+			t.Fatalf("done after %d ticks", i)
+		}
+		an.Update()
+	}
+	an.Update()
+	if !an.Done() || an.frame != 1 {
+		t.Errorf("wave on frame %d, done %v", an.frame, an.Done())
+	}
+	an.Update()
+	if an.frame != 1 {
+		t.Errorf("wave went on to frame %d", an.frame)
+	}
+}
+
+// Frames come off the sheet left to right, top to bottom
+func TestFrame(t *testing.T) {
+	an := NewAnimator(loadWalker(t), "wave")
+	img, flip := an.Frame()
+	if want := image.Rect(10, 20, 20, 40); img.Bounds() != want || flip {
+		t.Errorf("frame 4 at %v, flipped %v, want %v", img.Bounds(), flip, want)
+	}
+	an.PlayDir("walk", "down")
+	for i := 0; i < 15; i++ {
+		an.Update()
+	}
+	if img, _ := an.Frame(); img.Bounds() != image.Rect(0, 20, 10, 40) {
+		t.Errorf("frame 3 at %v", img.Bounds())
+	}
+}
+
+// Reloading an animation carries on with the clip where it was
+func TestSetAnimation(t *testing.T) {
+	an := NewAnimator(loadWalker(t), "walk_down")
+	for i := 0; i < 7; i++ {
+		an.Update()
+	}
+	an.SetAnimation(loadWalker(t))
+	if an.Clip() != "walk_down" || an.frame != 1 || an.ticks != 2 {
+		t.Errorf("after reloading, %s frame %d tick %d", an.Clip(), an.frame, an.ticks)
+	}
+}
+
+const mirrored = `{
+	"frameWidth": 10, "frameHeight": 20,
+	"skins": ["default", "Red"],
+	"sheets": {"right": "right{skin}.png", "left": "left{skin}.png"},
+	"mirror": {"left": "right"},
+	"clips": {
+		"walk_right": {"sheet": "right", "frames": [0], "duration": 1},
+		"walk_left": {"sheet": "left", "frames": [0], "duration": 1},
+		"moonwalk_left": {"sheet": "left", "frames": [0], "duration": 1, "flipX": true}
+	}
+}`
+
+func TestSkins(t *testing.T) {
+	var asked []string
+	load := sheets(map[string]image.Point{"right.png": {1, 1}, "rightRed.png": {1, 1}}, &asked)
+	if _, err := Load([]byte(mirrored), "", load); err != nil {
+		t.Fatal(err)
+	}
+	a, err := Load([]byte(mirrored), "Red", load)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Skin != "Red" || !strings.Contains(strings.Join(asked, " "), "rightRed.png") {
+		t.Errorf("Red loaded %q from %q", a.Skin, asked)
+	}
+	_, err = Load([]byte(mirrored), "Blue", load)
+	if err == nil || err.Error() != `no skin "Blue", there is default, Red` {
+		t.Errorf("got error %v for a missing skin", err)
+	}
+	if SkinPath("down{skin}.png", DefaultSkin) != "down.png" || SkinPath("down{skin}.png", "Red") != "downRed.png" {
+		t.Errorf("SkinPath gave %q and %q", SkinPath("down{skin}.png", DefaultSkin), SkinPath("down{skin}.png", "Red"))
+	}
+}
+
+func TestMirror(t *testing.T) {
+	// No left art, so it is the right sheet flipped
+	a, err := Load([]byte(mirrored), "", sheets(map[string]image.Point{"right.png": {1, 1}}, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	right, left, moon := a.Clips["walk_right"], a.Clips["walk_left"], a.Clips["moonwalk_left"]
+	if left.Sheet != right.Sheet || !left.FlipX || right.FlipX || moon.FlipX {
+		t.Errorf("mirrored flips are right %v, left %v, moonwalk %v", right.FlipX, left.FlipX, moon.FlipX)
+	}
+
+	// Left art of its own is used as drawn
+	a, err = Load([]byte(mirrored), "", sheets(map[string]image.Point{"right.png": {1, 1}, "left.png": {1, 1}}, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if left := a.Clips["walk_left"]; left.Sheet == a.Clips["walk_right"].Sheet || left.FlipX || !a.Clips["moonwalk_left"].FlipX {
+		t.Errorf("left art was mirrored anyway")
+	}
+
+	// Nothing to mirror from
+	_, err = Load([]byte(mirrored), "", sheets(nil, nil))
+	if err == nil || !strings.Contains(err.Error(), "sheet right") {
+		t.Errorf("got error %v without any art", err)
+	}
+	_, err = Load([]byte(strings.Replace(mirrored, `"mirror": {"left": "right"}`, `"mirror": {"left": "right", "right": "left"}`, 1)), "", sheets(nil, nil))
+	if err == nil || !strings.Contains(err.Error(), "which has no art") {
+		t.Errorf("got error %v mirroring each other without art", err)
+	}
+}
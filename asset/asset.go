@@ -0,0 +1,131 @@
+// Package asset loads the game's files, such as images, scene files and
+// dialogue, from one file system. Images are decoded once and cached by path,
+// and so are copies recoloured with a palette.
+//
+// During development the files are read from disk so edits show up without a
+// rebuild. Release builds can embed them instead, see embed.go in package
+// main.
+package asset
+
+import (
+	"bytes"
+	"ebi/palette"
+	"fmt"
+	"image"
+	_ "image/png"
+	"io/fs"
+	"os"
+	"path"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Manager hands out the files in a file system. Paths are slash separated
+// and relative to the root of the game, like "assets/playerUpBlack.png".
+type Manager struct {
+	fsys      fs.FS
+	images    map[string]*ebiten.Image
+	recolored map[string]map[string]*ebiten.Image // By path, then palette name
+}
+
+// New makes a manager reading from fsys
+func New(fsys fs.FS) *Manager {
+	return &Manager{
+		fsys:      fsys,
+		images:    make(map[string]*ebiten.Image),
+		recolored: make(map[string]map[string]*ebiten.Image),
+	}
+}
+
+// Disk makes a manager reading from the directory dir
+func Disk(dir string) *Manager {
+	return New(os.DirFS(dir))
+}
+
+// FS returns the file system the manager reads from
+func (m *Manager) FS() fs.FS {
+	return m.fsys
+}
+
+// Image returns the image at name, decoding it the first time it's asked for
+func (m *Manager) Image(name string) (*ebiten.Image, error) {
+	name = path.Clean(name)
+	if img, ok := m.images[name]; ok {
+		return img, nil
+	}
+	src, err := m.decode(name)
+	if err != nil {
+		return nil, err
+	}
+	img := ebiten.NewImageFromImage(src)
+	m.images[name] = img
+	return img, nil
+}
+
+// Recolored returns the image at name in the colours of a palette, or as it
+// is drawn if p is nil
+func (m *Manager) Recolored(name string, p *palette.Palette) (*ebiten.Image, error) {
+	if p == nil {
+		return m.Image(name)
+	}
+	name = path.Clean(name)
+	if img, ok := m.recolored[name][p.Name]; ok {
+		return img, nil
+	}
+	src, err := m.decode(name)
+	if err != nil {
+		return nil, err
+	}
+	img := ebiten.NewImageFromImage(p.Apply(src))
+	if m.recolored[name] == nil {
+		m.recolored[name] = make(map[string]*ebiten.Image)
+	}
+	m.recolored[name][p.Name] = img
+	return img, nil
+}
+
+func (m *Manager) decode(name string) (image.Image, error) {
+	data, err := fs.ReadFile(m.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return src, nil
+}
+
+// ReadFile returns the contents of the file at name
+func (m *Manager) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(m.fsys, path.Clean(name))
+}
+
+// Open opens the file at name for reading
+func (m *Manager) Open(name string) (fs.File, error) {
+	return m.fsys.Open(path.Clean(name))
+}
+
+// Glob returns the names of the files matching pattern, in order
+func (m *Manager) Glob(pattern string) ([]string, error) {
+	return fs.Glob(m.fsys, pattern)
+}
+
+// Exists reports whether there is a file at name
+func (m *Manager) Exists(name string) bool {
+	_, err := fs.Stat(m.fsys, path.Clean(name))
+	return err == nil
+}
+
+// Forget drops a cached image, and its recoloured copies, so the next Image
+// call reads it again
+func (m *Manager) Forget(name string) {
+	name = path.Clean(name)
+	delete(m.images, name)
+	delete(m.recolored, name)
+}
+
+// ForgetRecolored drops every recoloured copy, e.g. after the palettes changed
+func (m *Manager) ForgetRecolored() {
+	m.recolored = make(map[string]map[string]*ebiten.Image)
+}
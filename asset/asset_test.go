@@ -0,0 +1,177 @@
+package asset
+
+import (
+	"bytes"
+	"ebi/palette"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func pngData(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	img.Set(0, 0, color.NRGBA{0x12, 0x34, 0x56, 0xff})
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// testFiles returns the same files in a map file system, standing in for an
+// embed.FS, and on disk
+func testFiles(t *testing.T) map[string]*Manager {
+	t.Helper()
+	files := map[string][]byte{
+		"assets/hero.png": pngData(t, 4, 2),
+		"lang/en.json":    []byte(`{"hello": "Hello"}`),
+		"lang/ja.json":    []byte(`{"hello": "こんにちは"}`),
+	}
+	mapFS := fstest.MapFS{}
+	dir := t.TempDir()
+	for name, data := range files {
+		mapFS[name] = &fstest.MapFile{Data: data}
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return map[string]*Manager{"embedded": New(mapFS), "disk": Disk(dir)}
+}
+
+// Embedded and disk files are found the same way, by slash separated paths
+// that don't have to be clean
+func TestLookup(t *testing.T) {
+	for name, m := range testFiles(t) {
+		t.Run(name, func(t *testing.T) {
+			data, err := m.ReadFile("lang/../lang/./en.json")
+			if err != nil || string(data) != `{"hello": "Hello"}` {
+				t.Errorf("ReadFile gave %q, %v", data, err)
+			}
+			f, err := m.Open("assets//hero.png")
+			if err != nil {
+				t.Errorf("Open: %v", err)
+			} else {
+				f.Close()
+			}
+			if !m.Exists("assets/hero.png") || m.Exists("assets/villain.png") {
+				t.Error("Exists is wrong")
+			}
+			names, err := m.Glob("lang/*.json")
+			if want := []string{"lang/en.json", "lang/ja.json"}; err != nil || !reflect.DeepEqual(names, want) {
+				t.Errorf("Glob gave %q, %v, want %q", names, err, want)
+			}
+
+			img, err := m.Image("./assets/hero.png")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if w, h := img.Bounds().Dx(), img.Bounds().Dy(); w != 4 || h != 2 {
+				t.Errorf("image is %dx%d, want 4x2", w, h)
+			}
+			// Missing files must say so, package anim mirrors sheets that are
+			// missing but not ones that are broken
+			if _, err := m.Image("assets/villain.png"); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("missing image gave %v, want fs.ErrNotExist", err)
+			}
+			if _, err := m.Image("lang/en.json"); err == nil || errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("decoding JSON gave %v", err)
+			}
+		})
+	}
+}
+
+func TestImageCache(t *testing.T) {
+	m := testFiles(t)["embedded"]
+	a, err := m.Image("assets/hero.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := m.Image("assets/../assets/hero.png"); b != a {
+		t.Error("image decoded twice")
+	}
+	if b, _ := m.Recolored("assets/hero.png", nil); b != a {
+		t.Error("Recolored without a palette isn't the plain image")
+	}
+
+	green := &palette.Palette{Name: "green", Swaps: map[color.NRGBA]color.NRGBA{{0x12, 0x34, 0x56, 0xff}: {0, 0xff, 0, 0xff}}}
+	red := &palette.Palette{Name: "red", Swaps: map[color.NRGBA]color.NRGBA{{0x12, 0x34, 0x56, 0xff}: {0xff, 0, 0, 0xff}}}
+	g1, _ := m.Recolored("assets/hero.png", green)
+	g2, _ := m.Recolored("assets/hero.png", green)
+	r, _ := m.Recolored("assets/hero.png", red)
+	if g1 == nil || g1 != g2 || g1 == a || r == g1 {
+		t.Error("recoloured copies aren't cached by palette")
+	}
+
+	m.Forget("assets/hero.png")
+	if b, _ := m.Image("assets/hero.png"); b == a {
+		t.Error("Forget kept the image")
+	}
+	if g3, _ := m.Recolored("assets/hero.png", green); g3 == g1 {
+		t.Error("Forget kept the recoloured copy")
+	}
+	r2, _ := m.Recolored("assets/hero.png", red)
+	m.ForgetRecolored()
+	if r3, _ := m.Recolored("assets/hero.png", red); r3 == r2 {
+		t.Error("ForgetRecolored kept a recoloured copy")
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) {
+		t.Helper()
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("assets/hero.png", pngData(t, 4, 2))
+	write("lang/en.json", []byte(`{}`))
+	write("other/notes.txt", []byte(`not watched`))
+
+	m := Disk(dir)
+	w := m.Watch("assets", "lang")
+	if changed, err := w.Poll(); err != nil || len(changed) != 0 {
+		t.Fatalf("nothing changed, Poll gave %q, %v", changed, err)
+	}
+	old, err := m.Image("assets/hero.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write("assets/hero.png", pngData(t, 8, 8))
+	write("lang/ja.json", []byte(`{}`))
+	write("other/notes.txt", []byte(`still not watched`))
+	if err := os.Remove(filepath.Join(dir, "lang", "en.json")); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := w.Poll()
+	if want := []string{"assets/hero.png", "lang/en.json", "lang/ja.json"}; err != nil || !reflect.DeepEqual(changed, want) {
+		t.Errorf("Poll gave %q, %v, want %q", changed, err, want)
+	}
+	img, err := m.Image("assets/hero.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img == old || img.Bounds().Dx() != 8 {
+		t.Error("the changed image wasn't read again")
+	}
+	if changed, _ := w.Poll(); len(changed) != 0 {
+		t.Errorf("second Poll gave %q", changed)
+	}
+}
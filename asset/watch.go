@@ -0,0 +1,76 @@
+package asset
+
+import (
+	"io/fs"
+	"sort"
+	"time"
+)
+
+// Watcher notices files being added, changed or removed in some directories
+// of a manager's file system, for reloading them while the game runs. It
+// polls instead of asking the OS to tell it, which is plenty for a handful of
+// directories checked a couple of times a second.
+type Watcher struct {
+	m    *Manager
+	dirs []string
+	seen map[string]stamp
+}
+
+type stamp struct {
+	mod  time.Time
+	size int64
+}
+
+// Watch starts watching dirs. Changes are reported by Poll from now on.
+func (m *Manager) Watch(dirs ...string) *Watcher {
+	w := &Watcher{m: m, dirs: dirs}
+	w.seen, _ = w.scan()
+	return w
+}
+
+// Poll returns the files that were added, changed or removed since the last
+// call, in order, and forgets any cached images among them
+func (w *Watcher) Poll() ([]string, error) {
+	now, err := w.scan()
+	if err != nil {
+		return nil, err
+	}
+	var changed []string
+	for name, s := range now {
+		if old, ok := w.seen[name]; !ok || old != s {
+			changed = append(changed, name)
+		}
+	}
+	for name := range w.seen {
+		if _, ok := now[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	for _, name := range changed {
+		w.m.Forget(name)
+	}
+	w.seen = now
+	return changed, nil
+}
+
+func (w *Watcher) scan() (map[string]stamp, error) {
+	files := make(map[string]stamp)
+	for _, dir := range w.dirs {
+		err := fs.WalkDir(w.m.fsys, dir, func(name string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			files[name] = stamp{info.ModTime(), info.Size()}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
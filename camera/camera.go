@@ -0,0 +1,111 @@
+// Package camera turns world (map pixel) coordinates into screen coordinates.
+package camera
+
+import (
+	"image"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+type Camera struct {
+	X, Y                  float64         // World position shown at the centre of the screen
+	Zoom                  float64         // Screen pixels per world pixel
+	ViewWidth, ViewHeight float64         // Size of the screen
+	Bounds                image.Rectangle // World area the view is kept inside, empty for none
+	FollowSpeed           float64         // Share of the distance to the target covered each frame, 1 snaps
+	targetX, targetY      float64
+
+	// Effects, see effects.go
+	detached               bool
+	panX, panY, zoom       tween
+	shakeIntensity         float64
+	shakeFrames, shakeLeft int
+	shakeX, shakeY         float64
+}
+
+func New(viewWidth, viewHeight int, zoom float64) *Camera {
+	return &Camera{
+		Zoom:        zoom,
+		ViewWidth:   float64(viewWidth),
+		ViewHeight:  float64(viewHeight),
+		FollowSpeed: 0.25,
+	}
+}
+
+// Follow sets the world position the camera glides towards
+func (c *Camera) Follow(x, y float64) {
+	c.targetX, c.targetY = x, y
+}
+
+// Target returns the position the camera is heading for
+func (c *Camera) Target() (float64, float64) {
+	return c.targetX, c.targetY
+}
+
+// Snap jumps straight to a world position, e.g. after changing scenes
+func (c *Camera) Snap(x, y float64) {
+	c.targetX, c.targetY = x, y
+	c.X, c.Y = x, y
+	c.panX, c.panY = tween{}, tween{}
+	c.clamp()
+}
+
+// Update moves the camera a step closer to its target and runs any pan, zoom
+// or shake in progress. Call once per frame.
+func (c *Camera) Update() {
+	if !c.detached {
+		c.X += (c.targetX - c.X) * c.FollowSpeed
+		c.Y += (c.targetY - c.Y) * c.FollowSpeed
+		// Settle on the target instead of creeping towards it forever
+		if math.Abs(c.targetX-c.X) < 0.01 && math.Abs(c.targetY-c.Y) < 0.01 {
+			c.X, c.Y = c.targetX, c.targetY
+		}
+	}
+	c.updateEffects()
+	c.clamp()
+}
+
+// clamp keeps the view inside Bounds, centring maps smaller than the screen
+func (c *Camera) clamp() {
+	if c.Bounds.Empty() {
+		return
+	}
+	halfW := c.ViewWidth / (2 * c.Zoom)
+	halfH := c.ViewHeight / (2 * c.Zoom)
+	c.X = clampAxis(c.X, float64(c.Bounds.Min.X), float64(c.Bounds.Max.X), halfW)
+	c.Y = clampAxis(c.Y, float64(c.Bounds.Min.Y), float64(c.Bounds.Max.Y), halfH)
+}
+
+func clampAxis(v, min, max, half float64) float64 {
+	if max-min <= 2*half {
+		return (min + max) / 2
+	}
+	return math.Max(min+half, math.Min(max-half, v))
+}
+
+// GeoM returns the world to screen transform
+func (c *Camera) GeoM() ebiten.GeoM {
+	var m ebiten.GeoM
+	m.Translate(-c.X, -c.Y)
+	m.Scale(c.Zoom, c.Zoom)
+	m.Translate(c.ViewWidth/2+c.shakeX, c.ViewHeight/2+c.shakeY)
+	return m
+}
+
+// Apply adds the world to screen transform to m, for drawing something that
+// has already been placed in the world
+func (c *Camera) Apply(m *ebiten.GeoM) {
+	m.Concat(c.GeoM())
+}
+
+func (c *Camera) WorldToScreen(x, y float64) (float64, float64) {
+	m := c.GeoM()
+	return m.Apply(x, y)
+}
+
+func (c *Camera) ScreenToWorld(x, y float64) (float64, float64) {
+	m := c.GeoM()
+	m.Invert()
+	return m.Apply(x, y)
+}
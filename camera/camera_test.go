@@ -0,0 +1,95 @@
+package camera
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+func TestClamp(t *testing.T) {
+	bounds := image.Rect(0, 0, 1000, 800)
+	tests := []struct {
+		name         string
+		zoom         float64
+		x, y         float64
+		wantX, wantY float64
+	}{
+		{"inside", 1, 500, 400, 500, 400},
+		{"top left corner", 1, 0, 0, 160, 120},
+		{"bottom right corner", 1, 1000, 800, 840, 680},
+		{"zoomed in, top left", 2, 0, 0, 80, 60},
+		{"zoomed in, past the bottom right", 2, 2000, 2000, 920, 740},
+		// 0.25 shows 1280x960 of the map, more than there is, so it's centred
+		{"zoomed out past the map", 0.25, 0, 0, 500, 400},
+		// 0.3 shows about 1067x800, wider than the map but exactly as tall
+		{"zoomed out, as tall as the map", 0.3, 900, 0, 500, 400},
+	}
+	for _, tt := range tests {
+		c := New(320, 240, tt.zoom)
+		c.Bounds = bounds
+		c.Snap(tt.x, tt.y)
+		if math.Abs(c.X-tt.wantX) > 1e-9 || math.Abs(c.Y-tt.wantY) > 1e-9 {
+			t.Errorf("%s: camera at %v,%v, want %v,%v", tt.name, c.X, c.Y, tt.wantX, tt.wantY)
+		}
+	}
+
+	// Without bounds the camera goes anywhere
+	c := New(320, 240, 1)
+	c.Snap(-50, -60)
+	if c.X != -50 || c.Y != -60 {
+		t.Errorf("unbounded camera at %v,%v, want -50,-60", c.X, c.Y)
+	}
+}
+
+func TestFollow(t *testing.T) {
+	c := New(320, 240, 1)
+	c.Follow(100, -40)
+	c.Update()
+	if c.X != 25 || c.Y != -10 {
+		t.Errorf("after one frame camera at %v,%v, want a quarter of the way at 25,-10", c.X, c.Y)
+	}
+	for i := 0; i < 60; i++ {
+		c.Update()
+	}
+	if c.X != 100 || c.Y != -40 {
+		t.Errorf("camera settled at %v,%v, want exactly 100,-40", c.X, c.Y)
+	}
+
+	// Following something into a corner stops the view at the map's edge
+	c.Bounds = image.Rect(0, 0, 1000, 800)
+	c.Follow(0, 0)
+	for i := 0; i < 60; i++ {
+		c.Update()
+	}
+	if c.X != 160 || c.Y != 120 {
+		t.Errorf("camera in the corner at %v,%v, want 160,120", c.X, c.Y)
+	}
+
+	c.FollowSpeed = 1
+	c.Follow(500, 400)
+	c.Update()
+	if c.X != 500 || c.Y != 400 {
+		t.Errorf("a follow speed of 1 left the camera at %v,%v, want 500,400", c.X, c.Y)
+	}
+}
+
+func TestWorldToScreen(t *testing.T) {
+	c := New(320, 240, 2)
+	c.Snap(100, 50)
+	tests := []struct {
+		wx, wy, sx, sy float64
+	}{
+		{100, 50, 160, 120},
+		{110, 50, 180, 120},
+		{100, 40, 160, 100},
+		{20, 0, 0, 20},
+	}
+	for _, tt := range tests {
+		if sx, sy := c.WorldToScreen(tt.wx, tt.wy); sx != tt.sx || sy != tt.sy {
+			t.Errorf("world %v,%v on screen at %v,%v, want %v,%v", tt.wx, tt.wy, sx, sy, tt.sx, tt.sy)
+		}
+		if wx, wy := c.ScreenToWorld(tt.sx, tt.sy); math.Abs(wx-tt.wx) > 1e-9 || math.Abs(wy-tt.wy) > 1e-9 {
+			t.Errorf("screen %v,%v in the world at %v,%v, want %v,%v", tt.sx, tt.sy, wx, wy, tt.wx, tt.wy)
+		}
+	}
+}
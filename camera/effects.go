@@ -0,0 +1,120 @@
+package camera
+
+import (
+	"math"
+	"math/rand"
+)
+
+// tween eases a value from one number to another over a number of frames
+type tween struct {
+	from, to     float64
+	frame, total int
+}
+
+func (t *tween) active() bool {
+	return t.frame < t.total
+}
+
+func (t *tween) step() float64 {
+	t.frame++
+	if t.frame >= t.total {
+		// Land exactly on the end value, which the sum below can miss by a bit
+		return t.to
+	}
+	p := float64(t.frame) / float64(t.total)
+	p = p * p * (3 - 2*p) // Smoothstep, slow at both ends
+	return t.from + (t.to-t.from)*p
+}
+
+// PanTo glides the camera to a world position over the given number of
+// frames. The camera stops following its target until Attach is called.
+func (c *Camera) PanTo(x, y float64, frames int) {
+	c.detached = true
+	if frames <= 0 {
+		c.X, c.Y = x, y
+		c.panX, c.panY = tween{}, tween{}
+		return
+	}
+	c.panX = tween{from: c.X, to: x, total: frames}
+	c.panY = tween{from: c.Y, to: y, total: frames}
+}
+
+// Panning reports whether a PanTo is still under way
+func (c *Camera) Panning() bool {
+	return c.panX.active() || c.panY.active()
+}
+
+// ZoomTo changes the zoom over the given number of frames
+func (c *Camera) ZoomTo(zoom float64, frames int) {
+	if frames <= 0 {
+		c.Zoom = zoom
+		c.zoom = tween{}
+		return
+	}
+	c.zoom = tween{from: c.Zoom, to: zoom, total: frames}
+}
+
+// Zooming reports whether a ZoomTo is still under way
+func (c *Camera) Zooming() bool {
+	return c.zoom.active()
+}
+
+// Shake jolts the view by up to intensity screen pixels, dying down to
+// nothing over the given number of frames
+func (c *Camera) Shake(intensity float64, frames int) {
+	c.shakeIntensity = intensity
+	c.shakeFrames = frames
+	c.shakeLeft = frames
+}
+
+// Shaking reports whether the screen is still shaking
+func (c *Camera) Shaking() bool {
+	return c.shakeLeft > 0
+}
+
+// Detach stops the camera from following its target, e.g. for a cutscene
+func (c *Camera) Detach() {
+	c.detached = true
+}
+
+// Attach hands the camera back to its target. The usual follow smoothing
+// carries it back from wherever it was panned to.
+func (c *Camera) Attach() {
+	c.detached = false
+	c.panX, c.panY = tween{}, tween{}
+}
+
+// Settled reports whether the camera has stopped moving
+func (c *Camera) Settled() bool {
+	if c.Panning() || c.Zooming() {
+		return false
+	}
+	if c.detached {
+		return true
+	}
+	// The target itself may be outside the bounds, so compare against
+	// where the camera would end up
+	x, y := c.X, c.Y
+	c.X, c.Y = c.targetX, c.targetY
+	c.clamp()
+	tx, ty := c.X, c.Y
+	c.X, c.Y = x, y
+	return math.Abs(tx-x) < 0.5 && math.Abs(ty-y) < 0.5
+}
+
+func (c *Camera) updateEffects() {
+	if c.Panning() {
+		c.X = c.panX.step()
+		c.Y = c.panY.step()
+	}
+	if c.Zooming() {
+		c.Zoom = c.zoom.step()
+	}
+	c.shakeX, c.shakeY = 0, 0
+	if c.shakeLeft > 0 {
+		amp := c.shakeIntensity * float64(c.shakeLeft) / float64(c.shakeFrames)
+		c.shakeX = (rand.Float64()*2 - 1) * amp
+		c.shakeY = (rand.Float64()*2 - 1) * amp
+		c.shakeLeft--
+	}
+}
@@ -0,0 +1,167 @@
+package camera
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+func TestPanTo(t *testing.T) {
+	c := New(320, 240, 1)
+	c.Snap(10.1, 20.7)
+	c.PanTo(300.3, -40.9, 7)
+	if !c.Panning() || c.Settled() {
+		t.Fatal("camera should be panning")
+	}
+	lastX := c.X
+	for i := 0; i < 7; i++ {
+		c.Update()
+		if c.X < lastX {
+			t.Errorf("frame %d: pan went back from %v to %v", i, lastX, c.X)
+		}
+		lastX = c.X
+	}
+	if c.X != 300.3 || c.Y != -40.9 {
+		t.Errorf("pan ended at %v,%v, want exactly 300.3,-40.9", c.X, c.Y)
+	}
+	if c.Panning() || !c.Settled() {
+		t.Errorf("pan should be over, panning %v settled %v", c.Panning(), c.Settled())
+	}
+
+	// Still detached, so the camera stays put rather than going back to its
+	// target
+	c.Update()
+	if c.X != 300.3 || c.Y != -40.9 {
+		t.Errorf("detached camera drifted to %v,%v", c.X, c.Y)
+	}
+
+	// Attaching glides back to the target
+	c.Attach()
+	if c.Settled() {
+		t.Error("camera away from its target should not be settled")
+	}
+	for i := 0; i < 60; i++ {
+		c.Update()
+	}
+	if c.X != 10.1 || c.Y != 20.7 || !c.Settled() {
+		t.Errorf("attached camera at %v,%v, want back at 10.1,20.7", c.X, c.Y)
+	}
+
+	// No frames jumps straight there
+	c.PanTo(5, 6, 0)
+	if c.X != 5 || c.Y != 6 || c.Panning() {
+		t.Errorf("instant pan at %v,%v panning %v", c.X, c.Y, c.Panning())
+	}
+}
+
+func TestPanToClamped(t *testing.T) {
+	c := New(320, 240, 1)
+	c.Bounds = image.Rect(0, 0, 1000, 800)
+	c.Snap(500, 400)
+	c.PanTo(0, 0, 10)
+	for i := 0; i < 10; i++ {
+		c.Update()
+	}
+	if c.X != 160 || c.Y != 120 || !c.Settled() {
+		t.Errorf("pan past the map's edge ended at %v,%v, want 160,120", c.X, c.Y)
+	}
+}
+
+func TestZoomTo(t *testing.T) {
+	c := New(320, 240, 0.25)
+	c.ZoomTo(0.7, 9)
+	if !c.Zooming() || c.Settled() {
+		t.Fatal("camera should be zooming")
+	}
+	last := c.Zoom
+	for i := 0; i < 9; i++ {
+		c.Update()
+		if c.Zoom < last {
+			t.Errorf("frame %d: zoom went back from %v to %v", i, last, c.Zoom)
+		}
+		last = c.Zoom
+	}
+	if c.Zoom != 0.7 || c.Zooming() || !c.Settled() {
+		t.Errorf("zoom ended at %v zooming %v, want exactly 0.7", c.Zoom, c.Zooming())
+	}
+
+	c.ZoomTo(2, 0)
+	if c.Zoom != 2 || c.Zooming() {
+		t.Errorf("instant zoom at %v zooming %v", c.Zoom, c.Zooming())
+	}
+}
+
+func TestShake(t *testing.T) {
+	c := New(320, 240, 1)
+	c.Snap(100, 100)
+	still := c.GeoM()
+
+	const intensity, frames = 8.0, 20
+	c.Shake(intensity, frames)
+	moved := false
+	for i := 0; i < frames; i++ {
+		if !c.Shaking() {
+			t.Fatalf("frame %d: shake stopped early", i)
+		}
+		c.Update()
+		// The shake dies down linearly
+		limit := intensity * float64(frames-i) / frames
+		if math.Abs(c.shakeX) > limit || math.Abs(c.shakeY) > limit {
+			t.Errorf("frame %d: shook by %v,%v, more than %v", i, c.shakeX, c.shakeY, limit)
+		}
+		if c.shakeX != 0 || c.shakeY != 0 {
+			moved = true
+		}
+	}
+	if !moved {
+		t.Error("the screen never shook")
+	}
+	if c.Shaking() {
+		t.Error("still shaking after the last frame")
+	}
+
+	// The first frame after the shake puts the view back
+	c.Update()
+	if c.shakeX != 0 || c.shakeY != 0 || c.GeoM() != still {
+		t.Errorf("view still offset by %v,%v after the shake", c.shakeX, c.shakeY)
+	}
+	// Shaking doesn't move the camera itself
+	if c.X != 100 || c.Y != 100 {
+		t.Errorf("camera moved to %v,%v", c.X, c.Y)
+	}
+}
+
+func TestSettled(t *testing.T) {
+	c := New(320, 240, 1)
+	if !c.Settled() {
+		t.Error("a new camera should be settled")
+	}
+	c.Follow(50, 0)
+	if c.Settled() {
+		t.Error("camera with somewhere to go should not be settled")
+	}
+	for i := 0; i < 60 && !c.Settled(); i++ {
+		c.Update()
+	}
+	if !c.Settled() || math.Abs(c.X-50) >= 0.5 {
+		t.Errorf("camera never settled, at %v,%v", c.X, c.Y)
+	}
+
+	// A target outside the bounds counts as reached once the camera is
+	// against the edge
+	c.Bounds = image.Rect(0, 0, 1000, 800)
+	c.Follow(-500, -500)
+	for i := 0; i < 60; i++ {
+		c.Update()
+	}
+	if !c.Settled() {
+		t.Errorf("camera against the edge at %v,%v is not settled", c.X, c.Y)
+	}
+
+	// Shaking alone doesn't unsettle the camera
+	c.Shake(4, 10)
+	c.Update()
+	if !c.Settled() {
+		t.Error("shaking camera is not settled")
+	}
+}
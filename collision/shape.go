@@ -0,0 +1,204 @@
+// Package collision holds the static collision shapes of a scene and moves
+// boxes through them, sliding along walls instead of stopping dead.
+package collision
+
+import (
+	"math"
+	"sort"
+)
+
+// Overlaps smaller than this are treated as touching, not colliding
+const epsilon = 1e-9
+
+type Vec struct {
+	X, Y float64
+}
+
+func (v Vec) Add(o Vec) Vec       { return Vec{v.X + o.X, v.Y + o.Y} }
+func (v Vec) Sub(o Vec) Vec       { return Vec{v.X - o.X, v.Y - o.Y} }
+func (v Vec) Scale(s float64) Vec { return Vec{v.X * s, v.Y * s} }
+func (v Vec) Dot(o Vec) float64   { return v.X*o.X + v.Y*o.Y }
+func (v Vec) Len() float64        { return math.Hypot(v.X, v.Y) }
+func (v Vec) cross(o Vec) float64 { return v.X*o.Y - v.Y*o.X }
+func (v Vec) perp() Vec           { return Vec{-v.Y, v.X} }
+func (v Vec) normalize() (Vec, bool) {
+	l := v.Len()
+	if l < epsilon {
+		return Vec{}, false
+	}
+	return Vec{v.X / l, v.Y / l}, true
+}
+
+// Shape is anything that can block movement. All shapes are convex.
+type Shape interface {
+	Bounds() Rect
+	vertices() []Vec
+}
+
+// Rect is an axis aligned box
+type Rect struct {
+	Min, Max Vec
+}
+
+// NewRect makes a rect from two corners given in any order, like image.Rect
+func NewRect(x1, y1, x2, y2 float64) Rect {
+	return Rect{
+		Min: Vec{math.Min(x1, x2), math.Min(y1, y2)},
+		Max: Vec{math.Max(x1, x2), math.Max(y1, y2)},
+	}
+}
+
+func (r Rect) Bounds() Rect { return r }
+
+func (r Rect) vertices() []Vec {
+	return []Vec{r.Min, {r.Max.X, r.Min.Y}, r.Max, {r.Min.X, r.Max.Y}}
+}
+
+func (r Rect) Translate(d Vec) Rect {
+	return Rect{r.Min.Add(d), r.Max.Add(d)}
+}
+
+// Intersects reports whether two rects overlap, touching edges don't count
+func (r Rect) Intersects(o Rect) bool {
+	return r.Min.X < o.Max.X && o.Min.X < r.Max.X && r.Min.Y < o.Max.Y && o.Min.Y < r.Max.Y
+}
+
+func (r Rect) union(o Rect) Rect {
+	return Rect{
+		Min: Vec{math.Min(r.Min.X, o.Min.X), math.Min(r.Min.Y, o.Min.Y)},
+		Max: Vec{math.Max(r.Max.X, o.Max.X), math.Max(r.Max.Y, o.Max.Y)},
+	}
+}
+
+// Polygon is a convex polygon. Use ConvexHull to build one from loose points.
+type Polygon []Vec
+
+func (p Polygon) Bounds() Rect {
+	b := Rect{Min: p[0], Max: p[0]}
+	for _, v := range p[1:] {
+		b = b.union(Rect{v, v})
+	}
+	return b
+}
+
+func (p Polygon) vertices() []Vec { return p }
+
+// Segment is a wall with no thickness, e.g. a stretch of coastline
+type Segment struct {
+	A, B Vec
+}
+
+func (s Segment) Bounds() Rect {
+	return NewRect(s.A.X, s.A.Y, s.B.X, s.B.Y)
+}
+
+func (s Segment) vertices() []Vec { return []Vec{s.A, s.B} }
+
+// ConvexHull returns the smallest convex polygon containing all points.
+func ConvexHull(points []Vec) Polygon {
+	pts := append([]Vec{}, points...)
+	sort.Slice(pts, func(i, j int) bool {
+		if pts[i].X != pts[j].X {
+			return pts[i].X < pts[j].X
+		}
+		return pts[i].Y < pts[j].Y
+	})
+	if len(pts) < 3 {
+		return pts
+	}
+
+	// Andrew's monotone chain
+	hull := make([]Vec, 0, 2*len(pts))
+	for _, p := range pts {
+		for len(hull) >= 2 && hull[len(hull)-1].Sub(hull[len(hull)-2]).cross(p.Sub(hull[len(hull)-2])) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p)
+	}
+	lower := len(hull) + 1
+	for i := len(pts) - 2; i >= 0; i-- {
+		p := pts[i]
+		for len(hull) >= lower && hull[len(hull)-1].Sub(hull[len(hull)-2]).cross(p.Sub(hull[len(hull)-2])) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p)
+	}
+	return hull[:len(hull)-1]
+}
+
+// IsConvex reports whether the points, in order, form a convex polygon
+func IsConvex(points []Vec) bool {
+	if len(points) < 3 {
+		return false
+	}
+	sign := 0.0
+	for i := range points {
+		a, b, c := points[i], points[(i+1)%len(points)], points[(i+2)%len(points)]
+		z := b.Sub(a).cross(c.Sub(b))
+		if math.Abs(z) < epsilon {
+			continue
+		}
+		if sign == 0 {
+			sign = z
+		} else if (z > 0) != (sign > 0) {
+			return false
+		}
+	}
+	return sign != 0
+}
+
+// Penetration returns the smallest push that moves a out of b, using the
+// separating axis theorem. ok is false when the shapes don't overlap.
+func Penetration(a, b Shape) (push Vec, ok bool) {
+	va, vb := a.vertices(), b.vertices()
+	best := math.Inf(1)
+	for _, axis := range append(axes(va), axes(vb)...) {
+		minA, maxA := project(va, axis)
+		minB, maxB := project(vb, axis)
+		// How far a has to go back or forward along the axis to clear b.
+		// This is not the overlap itself, which is zero for a segment lying
+		// across a and too short when one shape is inside the other.
+		back, forward := maxA-minB, maxB-minA
+		if back <= epsilon || forward <= epsilon {
+			return Vec{}, false
+		}
+		if back < best {
+			best = back
+			push = axis.Scale(-back)
+		}
+		if forward < best {
+			best = forward
+			push = axis.Scale(forward)
+		}
+	}
+	return push, true
+}
+
+func axes(vs []Vec) []Vec {
+	var out []Vec
+	for i := range vs {
+		edge := vs[(i+1)%len(vs)].Sub(vs[i])
+		if n, ok := edge.perp().normalize(); ok {
+			out = append(out, n)
+		}
+		if len(vs) == 2 {
+			// A segment only has one edge, but it also needs its own direction
+			// as an axis so boxes can slip past its ends
+			if d, ok := edge.normalize(); ok {
+				out = append(out, d)
+			}
+			break
+		}
+	}
+	return out
+}
+
+func project(vs []Vec, axis Vec) (float64, float64) {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, v := range vs {
+		d := v.Dot(axis)
+		lo = math.Min(lo, d)
+		hi = math.Max(hi, d)
+	}
+	return lo, hi
+}
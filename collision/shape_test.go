@@ -0,0 +1,87 @@
+package collision
+
+import (
+	"math"
+	"testing"
+)
+
+func near(a, b Vec) bool {
+	return math.Abs(a.X-b.X) < 1e-6 && math.Abs(a.Y-b.Y) < 1e-6
+}
+
+func TestPenetration(t *testing.T) {
+	wall := Segment{A: Vec{10, 0}, B: Vec{10, 20}}
+	ramp := Polygon{{0, 0}, {10, 0}, {0, 10}}
+	tests := []struct {
+		name string
+		a, b Shape
+		push Vec
+		ok   bool
+	}{
+		{"rects overlapping on the left", NewRect(0, 0, 10, 10), NewRect(8, 2, 20, 8), Vec{-2, 0}, true},
+		{"rects overlapping below", NewRect(0, 7, 10, 17), NewRect(-5, 0, 15, 8), Vec{0, 1}, true},
+		{"rects touching", NewRect(0, 0, 10, 10), NewRect(10, 0, 20, 10), Vec{}, false},
+		{"rects apart", NewRect(0, 0, 10, 10), NewRect(0, 12, 10, 20), Vec{}, false},
+		{"rect inside a rect", NewRect(4, 1, 6, 3), NewRect(0, 0, 10, 10), Vec{0, -3}, true},
+		{"rect on a polygon's long side", NewRect(4, 4, 8, 8), ramp, Vec{1, 1}, true},
+		{"rect beyond a polygon's long side", NewRect(6, 6, 8, 8), ramp, Vec{}, false},
+		{"rect left of a segment", NewRect(7, 5, 11, 9), wall, Vec{-1, 0}, true},
+		{"rect right of a segment", NewRect(9, 5, 13, 9), wall, Vec{1, 0}, true},
+		{"rect past a segment's end", NewRect(8, 21, 12, 25), wall, Vec{}, false},
+		{"rect across a segment's end", NewRect(8, 19, 12, 23), wall, Vec{0, 1}, true},
+	}
+	for _, tt := range tests {
+		push, ok := Penetration(tt.a, tt.b)
+		if ok != tt.ok || !near(push, tt.push) {
+			t.Errorf("%s: got %v %v, want %v %v", tt.name, push, ok, tt.push, tt.ok)
+		}
+		if ok {
+			// The push has to actually separate the shapes
+			moved := tt.a.(Rect).Translate(push)
+			if _, still := Penetration(moved, tt.b); still {
+				t.Errorf("%s: still overlapping after the push", tt.name)
+			}
+		}
+	}
+}
+
+func TestConvexHull(t *testing.T) {
+	// A staircase of two 8x8 boxes
+	hull := ConvexHull([]Vec{
+		{0, 0}, {8, 0}, {0, 8}, {8, 8},
+		{8, 8}, {16, 8}, {8, 16}, {16, 16},
+	})
+	want := Polygon{{0, 0}, {8, 0}, {16, 8}, {16, 16}, {8, 16}, {0, 8}}
+	if len(hull) != len(want) {
+		t.Fatalf("hull %v, want %v", hull, want)
+	}
+	for i := range want {
+		if hull[i] != want[i] {
+			t.Fatalf("hull %v, want %v", hull, want)
+		}
+	}
+	if !IsConvex(hull) {
+		t.Errorf("hull %v is not convex", hull)
+	}
+	if b := hull.Bounds(); b != NewRect(0, 0, 16, 16) {
+		t.Errorf("hull bounds %v", b)
+	}
+}
+
+func TestIsConvex(t *testing.T) {
+	tests := []struct {
+		points []Vec
+		want   bool
+	}{
+		{[]Vec{{0, 0}, {10, 0}, {0, 10}}, true},
+		{[]Vec{{0, 0}, {0, 10}, {10, 0}}, true},
+		{[]Vec{{0, 0}, {10, 0}, {10, 10}, {5, 2}, {0, 10}}, false},
+		{[]Vec{{0, 0}, {5, 0}, {10, 0}}, false},
+		{[]Vec{{0, 0}, {10, 0}}, false},
+	}
+	for _, tt := range tests {
+		if got := IsConvex(tt.points); got != tt.want {
+			t.Errorf("IsConvex(%v) = %v, want %v", tt.points, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package collision
+
+import "math"
+
+// Default size of a grid cell in map pixels
+const DefaultCellSize = 128
+
+// Longest distance a box is moved in one go, so fast movers can't skip
+// through thin walls
+const maxStep = 8
+
+type cell struct {
+	X, Y int
+}
+
+// World is a uniform grid over a scene's static shapes. Shapes are stored in
+// every cell their bounds touch, so queries only look at nearby shapes.
+type World struct {
+	cellSize float64
+	cells    map[cell][]int
+	shapes   []Shape
+	// Number of the query each shape was last seen in, so a shape spanning
+	// several cells is only looked at once without allocating a set
+	seen  []uint32
+	query uint32
+}
+
+func NewWorld(cellSize float64) *World {
+	if cellSize <= 0 {
+		cellSize = DefaultCellSize
+	}
+	return &World{
+		cellSize: cellSize,
+		cells:    make(map[cell][]int),
+	}
+}
+
+// Len returns the number of shapes in the world
+func (w *World) Len() int {
+	return len(w.shapes)
+}
+
+// Shapes returns every shape in the order they were added
+func (w *World) Shapes() []Shape {
+	return w.shapes
+}
+
+func (w *World) Add(s Shape) {
+	id := len(w.shapes)
+	w.shapes = append(w.shapes, s)
+	w.seen = append(w.seen, 0)
+	w.forCells(s.Bounds(), func(c cell) {
+		w.cells[c] = append(w.cells[c], id)
+	})
+}
+
+// Clear removes every shape
+func (w *World) Clear() {
+	w.shapes = nil
+	w.seen = nil
+	w.cells = make(map[cell][]int)
+}
+
+// Query returns the shapes whose bounds overlap r
+func (w *World) Query(r Rect) []Shape {
+	var found []Shape
+	w.each(r, func(s Shape) {
+		found = append(found, s)
+	})
+	return found
+}
+
+// each calls fn once for every shape whose bounds overlap r
+func (w *World) each(r Rect, fn func(Shape)) {
+	w.query++
+	if w.query == 0 {
+		// Wrapped around, forget the old query numbers
+		for i := range w.seen {
+			w.seen[i] = 0
+		}
+		w.query = 1
+	}
+	w.forCells(r, func(c cell) {
+		for _, id := range w.cells[c] {
+			if w.seen[id] == w.query {
+				continue
+			}
+			w.seen[id] = w.query
+			if w.shapes[id].Bounds().Intersects(r) {
+				fn(w.shapes[id])
+			}
+		}
+	})
+}
+
+// Collides reports whether the box overlaps any shape
+func (w *World) Collides(box Rect) bool {
+	hit := false
+	w.each(box, func(s Shape) {
+		if _, ok := Penetration(box, s); ok {
+			hit = true
+		}
+	})
+	return hit
+}
+
+// Move tries to move box by delta. Whenever the box runs into a shape it is
+// pushed back out along the shortest way, which keeps the part of the motion
+// running parallel to the wall. It returns how far the box actually moved and
+// whether it hit anything.
+func (w *World) Move(box Rect, delta Vec) (Vec, bool) {
+	steps := int(math.Ceil(math.Max(math.Abs(delta.X), math.Abs(delta.Y)) / maxStep))
+	if steps < 1 {
+		steps = 1
+	}
+	step := delta.Scale(1 / float64(steps))
+
+	moved := Vec{}
+	hit := false
+	for i := 0; i < steps; i++ {
+		next := moved.Add(step)
+		// A couple of passes settles corners where two shapes meet
+		for pass := 0; pass < 4; pass++ {
+			push, ok := w.deepest(box.Translate(next))
+			if !ok {
+				break
+			}
+			hit = true
+			next = next.Add(push)
+		}
+		moved = next
+	}
+	return moved, hit
+}
+
+// deepest returns the largest push needed to separate box from the world
+func (w *World) deepest(box Rect) (Vec, bool) {
+	var best Vec
+	found := false
+	w.each(box, func(s Shape) {
+		if push, ok := Penetration(box, s); ok && (!found || push.Len() > best.Len()) {
+			best = push
+			found = true
+		}
+	})
+	return best, found
+}
+
+func (w *World) forCells(r Rect, fn func(cell)) {
+	x0 := int(math.Floor(r.Min.X / w.cellSize))
+	y0 := int(math.Floor(r.Min.Y / w.cellSize))
+	x1 := int(math.Floor(r.Max.X / w.cellSize))
+	y1 := int(math.Floor(r.Max.Y / w.cellSize))
+	for y := y0; y <= y1; y++ {
+		for x := x0; x <= x1; x++ {
+			fn(cell{x, y})
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package collision
+
+import (
+	"math"
+	"testing"
+)
+
+func TestQuery(t *testing.T) {
+	w := NewWorld(16)
+	long := NewRect(10, 0, 40, 4)     // Spans cells 0, 1 and 2
+	corner := NewRect(14, 14, 18, 18) // Spans four cells around 16, 16
+	far := NewRect(100, 100, 104, 104)
+	w.Add(long)
+	w.Add(corner)
+	w.Add(far)
+
+	tests := []struct {
+		name string
+		r    Rect
+		want []Shape
+	}{
+		{"one cell of a long shape", NewRect(36, 0, 38, 2), []Shape{long}},
+		{"across two cells", NewRect(12, 2, 20, 16), []Shape{long, corner}},
+		{"the far corner of a shape", NewRect(17, 17, 20, 20), []Shape{corner}},
+		{"same cells but no overlap", NewRect(20, 20, 30, 30), nil},
+		{"touching edges only", NewRect(18, 18, 20, 20), nil},
+	}
+	for _, tt := range tests {
+		got := w.Query(tt.r)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+			}
+		}
+	}
+
+	// Shapes spanning several cells are only returned once
+	if got := w.Query(NewRect(0, 0, 48, 48)); len(got) != 2 {
+		t.Errorf("big query got %v, want the long and corner shapes once each", got)
+	}
+	w.Clear()
+	if got := w.Query(NewRect(0, 0, 200, 200)); len(got) != 0 || w.Len() != 0 {
+		t.Errorf("cleared world still has %v", got)
+	}
+}
+
+// Looking through cells full of shapes that don't overlap mustn't allocate,
+// as the player's box is checked every frame
+func TestQueryAllocations(t *testing.T) {
+	w := NewWorld(16)
+	for i := 0; i < 10; i++ {
+		w.Add(NewRect(float64(i*20), 0, float64(i*20+30), 30))
+	}
+	box := NewRect(0, 31, 200, 40)
+	allocs := testing.AllocsPerRun(100, func() {
+		if w.Collides(box) || len(w.Query(box)) != 0 {
+			t.Fatal("box should be clear of the shapes")
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("got %v allocations per query, want 0", allocs)
+	}
+}
+
+func TestMove(t *testing.T) {
+	w := NewWorld(DefaultCellSize)
+	w.Add(NewRect(20, 0, 30, 100))                // A wall to the right
+	w.Add(Segment{A: Vec{0, 50}, B: Vec{15, 50}}) // A fence below
+	w.Add(Polygon{{40, 0}, {100, 0}, {100, 60}})  // A slope past the wall
+	box := NewRect(0, 0, 10, 10)
+
+	tests := []struct {
+		name  string
+		box   Rect
+		delta Vec
+		moved Vec
+		hit   bool
+	}{
+		{"free", box, Vec{3, 4}, Vec{3, 4}, false},
+		{"into the wall", box.Translate(Vec{5, 0}), Vec{10, 0}, Vec{5, 0}, true},
+		{"slide down the wall", box.Translate(Vec{8, 0}), Vec{4, 6}, Vec{2, 6}, true},
+		{"slide along the fence", box.Translate(Vec{0, 36}), Vec{3, 8}, Vec{3, 4}, true},
+		{"fast into the fence", NewRect(0, 0, 10, 20), Vec{0, 60}, Vec{0, 30}, true},
+	}
+	for _, tt := range tests {
+		moved, hit := w.Move(tt.box, tt.delta)
+		if hit != tt.hit || !near(moved, tt.moved) {
+			t.Errorf("%s: moved %v hit %v, want %v %v", tt.name, moved, hit, tt.moved, tt.hit)
+		}
+	}
+
+	// Walking right into the slope slides down along it
+	start := NewRect(40, 20, 50, 30)
+	delta := Vec{20, 0}
+	moved, hit := w.Move(start, delta)
+	if !hit || moved.X >= delta.X || moved.Y <= 0 {
+		t.Errorf("into the slope moved %v hit %v", moved, hit)
+	}
+	if w.Collides(start.Translate(moved)) {
+		t.Errorf("box ended up inside the slope at %v", start.Translate(moved))
+	}
+	// The slope only pushes back along its normal, (-1, 1)
+	if push := moved.Sub(delta); math.Abs(push.X+push.Y) > 1e-6 {
+		t.Errorf("slope pushed the box by %v", push)
+	}
+}
@@ -0,0 +1,695 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Action is one step of a cutscene. Start is called on the first frame the
+// action runs, then Update every frame (including that first one) until Done
+// reports true.
+type Action interface {
+	Start(g *Game)
+	Update(g *Game)
+	Done() bool
+}
+
+// Actions that can be checked before the cutscene plays implement validator,
+// so a broken cutscene fails when it is built instead of halfway through
+type validator interface {
+	validate(g *Game) error
+}
+
+// Actions that can jump straight to their end state implement skipper. Any
+// other action is updated until it is done when the cutscene is skipped.
+type skipper interface {
+	skip(g *Game)
+}
+
+// Actor is something a cutscene can move around, the player or an NPC
+type Actor interface {
+	Position() (float64, float64)
+	SetPosition(x, y float64)
+	Face(dir string)
+	Size() (int, int)
+	Walk(moving bool)
+}
+
+type CutsceneAction struct {
+	Action
+	WaitPrevious bool // Whether to wait for previous actions to complete
+}
+
+// A cutscene runs one or more tracks side by side, each a list of actions
+// played in order. An action with WaitPrevious unset runs alongside the one
+// before it, and the track only moves on once they have all finished.
+// LabelAction, JumpAction, WaitAction and JoinAction give a track loops,
+// branches and pauses. The cutscene ends when every track has.
+type Cutscene struct {
+	Game      *Game `json:"-"`
+	Tracks    []*Track
+	IsPlaying bool
+	CleanUp   func(*Cutscene) `json:"-"`
+}
+
+type Track struct {
+	Name    string
+	Actions []CutsceneAction
+	Current int            // First action of the group being played
+	Active  map[int]bool   // Actions of the current group that have started
+	Done    map[int]bool   // Actions of the current group that have finished
+	labels  map[string]int // Label name to action index
+
+	skipping bool
+}
+
+// A track keeps running actions that finish straight away (teleports, jumps)
+// within one frame, up to this many groups so a loop of them can't hang the
+// game
+const maxGroupsPerFrame = 100
+
+// Skipping gives up on a track after this many groups, in case it loops forever
+const maxSkipGroups = 10000
+
+// NewCutscene checks every action and returns a cutscene ready to Start. The
+// first track is usually called "main".
+func NewCutscene(g *Game, tracks []*Track) (Cutscene, error) {
+	names := make(map[string]bool)
+	for _, t := range tracks {
+		if names[t.Name] {
+			return Cutscene{}, fmt.Errorf("track %q is defined twice", t.Name)
+		}
+		names[t.Name] = true
+	}
+	for _, t := range tracks {
+		t.labels = make(map[string]int)
+		for i, a := range t.Actions {
+			if l, ok := a.Action.(*LabelAction); ok {
+				if _, dup := t.labels[l.Name]; dup {
+					return Cutscene{}, fmt.Errorf("track %s: label %q is defined twice", t.Name, l.Name)
+				}
+				t.labels[l.Name] = i
+			}
+		}
+		for i, a := range t.Actions {
+			if err := validateAction(g, a.Action); err != nil {
+				return Cutscene{}, fmt.Errorf("track %s, action %d: %v", t.Name, i+1, err)
+			}
+			if err := t.checkFlow(i, names); err != nil {
+				return Cutscene{}, fmt.Errorf("track %s, action %d: %v", t.Name, i+1, err)
+			}
+		}
+	}
+	return Cutscene{Game: g, Tracks: tracks}, nil
+}
+
+// checkFlow checks the jumps and joins of a track against its labels and the
+// other tracks
+func (t *Track) checkFlow(i int, tracks map[string]bool) error {
+	switch a := t.Actions[i].Action.(type) {
+	case *JumpAction:
+		if _, ok := t.labels[a.Label]; !ok {
+			return fmt.Errorf("unknown label %q", a.Label)
+		}
+		if !t.Actions[i].WaitPrevious || (i+1 < len(t.Actions) && !t.Actions[i+1].WaitPrevious) {
+			return fmt.Errorf("a jump can't run alongside other actions")
+		}
+	case *JoinAction:
+		for _, name := range a.Tracks {
+			if !tracks[name] {
+				return fmt.Errorf("unknown track %q", name)
+			}
+			if name == t.Name {
+				return fmt.Errorf("track %s can't wait for itself", name)
+			}
+		}
+	}
+	return nil
+}
+
+func validateAction(g *Game, a Action) error {
+	if a == nil {
+		return fmt.Errorf("missing action")
+	}
+	if v, ok := a.(validator); ok {
+		return v.validate(g)
+	}
+	return nil
+}
+
+func (c *Cutscene) Start() {
+	c.IsPlaying = true
+	for _, t := range c.Tracks {
+		t.Current = 0
+		t.Active = make(map[int]bool)
+		t.Done = make(map[int]bool)
+	}
+}
+
+func (c *Cutscene) Update() {
+	if !c.IsPlaying {
+		return
+	}
+
+	finished := true
+	for _, t := range c.Tracks {
+		t.update(c.Game)
+		if !t.Finished() {
+			finished = false
+		}
+	}
+
+	// Check if all tracks are completed
+	if finished {
+		c.Game.camera.Attach()
+		if c.CleanUp != nil {
+			c.CleanUp(c)
+		}
+		c.IsPlaying = false
+		c.Game.state = PlayState
+	}
+}
+
+// Skip plays every remaining action to its end straight away, leaving actors
+// where they would have ended up and setting the cutscene's flags.
+func (c *Cutscene) Skip() {
+	if !c.IsPlaying {
+		return
+	}
+	for _, t := range c.Tracks {
+		t.skip(c.Game)
+	}
+	// Every track has finished, so this ends the cutscene
+	c.Update()
+	c.Game.resetCamera()
+}
+
+// Track returns the track with the given name, or nil
+func (c *Cutscene) Track(name string) *Track {
+	for _, t := range c.Tracks {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// Finished reports whether the track has played its last action
+func (t *Track) Finished() bool {
+	return t.Current >= len(t.Actions)
+}
+
+// groupEnd returns the index after the last action that runs alongside the
+// one at start
+func (t *Track) groupEnd(start int) int {
+	end := start + 1
+	for end < len(t.Actions) && !t.Actions[end].WaitPrevious {
+		end++
+	}
+	return end
+}
+
+func (t *Track) update(g *Game) {
+	t.run(g, maxGroupsPerFrame, false)
+}
+
+func (t *Track) skip(g *Game) {
+	// Tracks waiting on each other in a circle would otherwise skip forever
+	t.skipping = true
+	defer func() { t.skipping = false }()
+	t.run(g, maxSkipGroups, true)
+	// Give up on a track that never ends
+	t.Current = len(t.Actions)
+}
+
+func (t *Track) run(g *Game, maxGroups int, skip bool) {
+	for n := 0; n < maxGroups && !t.Finished(); n++ {
+		end := t.groupEnd(t.Current)
+		finished := true
+		for i := t.Current; i < end; i++ {
+			if t.Done[i] {
+				continue
+			}
+			action := t.Actions[i]
+			if !t.Active[i] {
+				t.Active[i] = true
+				action.Start(g)
+			}
+			if skip {
+				skipAction(g, action.Action)
+			} else {
+				action.Update(g)
+			}
+			if action.Done() {
+				t.Active[i] = false
+				t.Done[i] = true
+			} else {
+				finished = false
+			}
+		}
+		if !finished {
+			return
+		}
+
+		next := end
+		if j, ok := t.Actions[t.Current].Action.(*JumpAction); ok && j.jump {
+			next = t.labels[j.Label]
+		}
+		for i := t.Current; i < end; i++ {
+			delete(t.Done, i)
+		}
+		t.Current = next
+	}
+}
+
+func skipAction(g *Game, a Action) {
+	if s, ok := a.(skipper); ok {
+		s.skip(g)
+		return
+	}
+	for n := 0; n < maxSkipGroups && !a.Done(); n++ {
+		a.Update(g)
+	}
+}
+
+// LabelAction marks a place in a track that a JumpAction can go to
+type LabelAction struct {
+	Name string
+}
+
+func (a *LabelAction) Start(g *Game)  {}
+func (a *LabelAction) Update(g *Game) {}
+func (a *LabelAction) Done() bool     { return true }
+
+// JumpAction carries on from the label with the given name in the same track,
+// if If is nil or returns true. With Count above zero it only jumps that many
+// times in a row before letting the track carry on, which makes a loop.
+type JumpAction struct {
+	Label string
+	If    func(g *Game) bool
+	Count int
+	jumps int
+	jump  bool
+}
+
+func (a *JumpAction) Start(g *Game) {
+	a.jump = a.If == nil || a.If(g)
+	if a.jump && a.Count > 0 {
+		a.jumps++
+		if a.jumps > a.Count {
+			// Loop finished, reset for the next time the track gets here
+			a.jump = false
+			a.jumps = 0
+		}
+	}
+}
+
+func (a *JumpAction) Update(g *Game) {}
+func (a *JumpAction) Done() bool     { return true }
+
+// WaitAction does nothing for the given number of frames. Actions finish
+// during an update and the next one starts on that same frame, so a wait is
+// done on the frame after the ones it waits.
+type WaitAction struct {
+	Frames int
+	left   int
+}
+
+func (a *WaitAction) Start(g *Game)  { a.left = a.Frames + 1 }
+func (a *WaitAction) Update(g *Game) { a.left-- }
+func (a *WaitAction) Done() bool     { return a.left <= 0 }
+func (a *WaitAction) skip(g *Game)   { a.left = 0 }
+
+// JoinAction waits until the named tracks of the playing cutscene are done
+type JoinAction struct {
+	Tracks []string
+	done   bool
+}
+
+func (a *JoinAction) Start(g *Game) { a.done = false }
+func (a *JoinAction) Done() bool    { return a.done }
+
+func (a *JoinAction) Update(g *Game) {
+	for _, name := range a.Tracks {
+		if !g.Cutscene.Track(name).Finished() {
+			return
+		}
+	}
+	a.done = true
+}
+
+// Skipping plays the joined tracks to their end first, so whatever comes
+// after the join still happens after them
+func (a *JoinAction) skip(g *Game) {
+	for _, name := range a.Tracks {
+		if t := g.Cutscene.Track(name); !t.skipping {
+			t.skip(g)
+		}
+	}
+	a.done = true
+}
+
+func checkActor(a Actor) error {
+	if a == nil {
+		return fmt.Errorf("missing actor")
+	}
+	return nil
+}
+
+func checkDirection(dir string) error {
+	switch dir {
+	case "up", "down", "left", "right":
+		return nil
+	}
+	return fmt.Errorf("unknown direction %q", dir)
+}
+
+// MoveAction walks an actor to a point, first along X and then along Y
+type MoveAction struct {
+	Actor Actor
+	To    Vector2D
+	Speed float64 // Pixels per frame, 5 if zero
+	done  bool
+}
+
+func (a *MoveAction) validate(g *Game) error { return checkActor(a.Actor) }
+func (a *MoveAction) Start(g *Game)          { a.done = false }
+func (a *MoveAction) Done() bool             { return a.done }
+
+func (a *MoveAction) Update(g *Game) {
+	speed := a.Speed
+	if speed == 0 {
+		speed = 5
+	}
+	x, y := a.Actor.Position()
+	switch {
+	case x > a.To.X:
+		a.Actor.Face("left")
+		x = math.Max(x-speed, a.To.X)
+	case x < a.To.X:
+		a.Actor.Face("right")
+		x = math.Min(x+speed, a.To.X)
+	case y < a.To.Y:
+		a.Actor.Face("down")
+		y = math.Min(y+speed, a.To.Y)
+	case y > a.To.Y:
+		a.Actor.Face("up")
+		y = math.Max(y-speed, a.To.Y)
+	default:
+		a.done = true
+	}
+	a.Actor.SetPosition(x, y)
+	a.Actor.Walk(!a.done)
+}
+
+func (a *MoveAction) skip(g *Game) {
+	// Face the way the last leg of the walk would have gone
+	x, y := a.Actor.Position()
+	switch {
+	case y < a.To.Y:
+		a.Actor.Face("down")
+	case y > a.To.Y:
+		a.Actor.Face("up")
+	case x > a.To.X:
+		a.Actor.Face("left")
+	case x < a.To.X:
+		a.Actor.Face("right")
+	}
+	a.Actor.SetPosition(a.To.X, a.To.Y)
+	a.Actor.Walk(false)
+	a.done = true
+}
+
+// TeleportAction puts an actor somewhere straight away
+type TeleportAction struct {
+	Actor Actor
+	To    Vector2D
+}
+
+func (a *TeleportAction) validate(g *Game) error { return checkActor(a.Actor) }
+func (a *TeleportAction) Start(g *Game)          { a.Actor.SetPosition(a.To.X, a.To.Y) }
+func (a *TeleportAction) Update(g *Game)         {}
+func (a *TeleportAction) Done() bool             { return true }
+
+// TurnAction makes an actor face up, down, left or right
+type TurnAction struct {
+	Actor     Actor
+	Direction string
+}
+
+func (a *TurnAction) validate(g *Game) error {
+	if err := checkActor(a.Actor); err != nil {
+		return err
+	}
+	return checkDirection(a.Direction)
+}
+func (a *TurnAction) Start(g *Game)  { a.Actor.Face(a.Direction) }
+func (a *TurnAction) Update(g *Game) {}
+func (a *TurnAction) Done() bool     { return true }
+
+// FadeAction fades the screen to black (Out) or back from it, changing the
+// fade alpha by Speed every frame
+type FadeAction struct {
+	Out   bool
+	Speed float64
+	done  bool
+}
+
+func (a *FadeAction) validate(g *Game) error {
+	if a.Speed <= 0 {
+		return fmt.Errorf("fade speed must be positive, got %v", a.Speed)
+	}
+	return nil
+}
+
+func (a *FadeAction) Start(g *Game) { a.done = false }
+func (a *FadeAction) Done() bool    { return a.done }
+
+func (a *FadeAction) skip(g *Game) {
+	if a.Out {
+		g.alpha = 1.0
+	} else {
+		g.alpha = 0.0
+	}
+	a.done = true
+}
+
+func (a *FadeAction) Update(g *Game) {
+	if a.Out {
+		g.alpha += a.Speed
+		if g.alpha >= 1.0 {
+			g.alpha = 1.0
+			a.done = true
+		}
+	} else {
+		g.alpha -= a.Speed
+		if g.alpha <= 0.0 {
+			// The scene is fully visible again
+			g.alpha = 0.0
+			a.done = true
+		}
+	}
+}
+
+// DialogueAction opens the dialogue box and waits until the conversation is
+// over. It plays Tree if set, otherwise it shows Lines.
+type DialogueAction struct {
+	Lines []string
+	Tree  *DialogueTree
+	done  bool
+}
+
+func (a *DialogueAction) validate(g *Game) error {
+	if a.Tree == nil && len(a.Lines) == 0 {
+		return fmt.Errorf("dialogue has no lines")
+	}
+	return nil
+}
+
+func (a *DialogueAction) Start(g *Game) {
+	tree := a.Tree
+	if tree == nil {
+		tree = LinesTree("", a.Lines)
+	}
+	g.dialogue.Open(g, tree)
+	a.done = !g.dialogue.IsOpen
+}
+
+func (a *DialogueAction) Done() bool { return a.done }
+
+// skip plays the rest of the conversation along its first choices, so its
+// effects happen as if the player had read through it
+func (a *DialogueAction) skip(g *Game) {
+	g.dialogue.Finish(g)
+	a.done = true
+}
+
+func (a *DialogueAction) Update(g *Game) {
+	d := g.dialogue
+	if ebiten.IsKeyPressed(ebiten.KeyZ) && !g.keyZPressedLastFrame {
+		d.Advance(g)
+		if !d.IsOpen {
+			a.done = true
+			return
+		}
+	}
+	d.Update()
+}
+
+// ChangeSceneAction takes the player to Spawn in another scene, the same way
+// walking through a door does. If the screen isn't black already it fades out
+// and back in at the door speed. After a FadeAction with Out set it switches
+// straight away and leaves fading back in to the next step.
+type ChangeSceneAction struct {
+	Scene     string
+	Spawn     Vector2D
+	Direction string // Which way the player faces on arrival, unchanged if empty
+	fades     bool   // Whether this action fades out and back in itself
+	switched  bool
+	done      bool
+}
+
+func (a *ChangeSceneAction) validate(g *Game) error {
+	if _, ok := g.Scenes[a.Scene]; !ok {
+		return fmt.Errorf("unknown scene %q", a.Scene)
+	}
+	if a.Direction != "" {
+		return checkDirection(a.Direction)
+	}
+	return nil
+}
+
+func (a *ChangeSceneAction) Start(g *Game) {
+	a.fades = g.alpha < 1.0
+	a.switched = false
+	a.done = false
+}
+
+func (a *ChangeSceneAction) Done() bool { return a.done }
+
+func (a *ChangeSceneAction) skip(g *Game) {
+	if !a.switched {
+		g.enterScene(a.Scene, a.Spawn.X, a.Spawn.Y)
+		if a.Direction != "" {
+			g.player.Direction = a.Direction
+		}
+		a.switched = true
+	}
+	if a.fades {
+		g.alpha = 0.0
+	}
+	a.done = true
+}
+
+func (a *ChangeSceneAction) Update(g *Game) {
+	if !a.switched {
+		if a.fades {
+			g.alpha += g.fadeSpeed
+			if g.alpha < 1.0 {
+				return
+			}
+			g.alpha = 1.0
+		}
+		g.enterScene(a.Scene, a.Spawn.X, a.Spawn.Y)
+		if a.Direction != "" {
+			g.player.Direction = a.Direction
+		}
+		a.switched = true
+		a.done = !a.fades
+		return
+	}
+	g.alpha -= g.fadeSpeed
+	if g.alpha <= 0.0 {
+		g.alpha = 0.0
+		a.done = true
+	}
+}
+
+// PanAction moves the camera to the middle of Target if set, otherwise to To
+type PanAction struct {
+	Target Actor
+	To     Vector2D
+	Frames int
+	done   bool
+}
+
+// target returns the world position the pan ends on
+func (a *PanAction) target() (float64, float64) {
+	if a.Target == nil {
+		return a.To.X, a.To.Y
+	}
+	x, y := a.Target.Position()
+	w, h := a.Target.Size()
+	return x + float64(w)/2, y + float64(h)/2
+}
+
+func (a *PanAction) Start(g *Game) {
+	x, y := a.target()
+	g.camera.PanTo(x, y, a.Frames)
+}
+
+func (a *PanAction) Update(g *Game) { a.done = !g.camera.Panning() }
+func (a *PanAction) Done() bool     { return a.done }
+
+func (a *PanAction) skip(g *Game) {
+	x, y := a.target()
+	g.camera.PanTo(x, y, 0)
+	a.done = true
+}
+
+// ZoomAction changes the camera zoom over Frames frames
+type ZoomAction struct {
+	Zoom   float64
+	Frames int
+	done   bool
+}
+
+func (a *ZoomAction) validate(g *Game) error {
+	if a.Zoom <= 0 {
+		return fmt.Errorf("zoom must be positive, got %v", a.Zoom)
+	}
+	return nil
+}
+
+func (a *ZoomAction) Start(g *Game)  { g.camera.ZoomTo(a.Zoom, a.Frames) }
+func (a *ZoomAction) Update(g *Game) { a.done = !g.camera.Zooming() }
+func (a *ZoomAction) Done() bool     { return a.done }
+
+func (a *ZoomAction) skip(g *Game) {
+	g.camera.ZoomTo(a.Zoom, 0)
+	a.done = true
+}
+
+// ShakeAction shakes the screen. Unless Wait is set the cutscene carries on
+// while it shakes.
+type ShakeAction struct {
+	Intensity float64
+	Frames    int
+	Wait      bool
+	done      bool
+}
+
+func (a *ShakeAction) Start(g *Game)  { g.camera.Shake(a.Intensity, a.Frames) }
+func (a *ShakeAction) Update(g *Game) { a.done = !a.Wait || !g.camera.Shaking() }
+func (a *ShakeAction) Done() bool     { return a.done }
+
+func (a *ShakeAction) skip(g *Game) {
+	g.camera.Shake(0, 0)
+	a.done = true
+}
+
+// FollowAction hands the camera back to the player and waits for it to catch up
+type FollowAction struct {
+	settled bool
+}
+
+func (a *FollowAction) Start(g *Game)  { g.camera.Attach() }
+func (a *FollowAction) Update(g *Game) { a.settled = g.camera.Settled() }
+func (a *FollowAction) Done() bool     { return a.settled }
+
+func (a *FollowAction) skip(g *Game) {
+	g.camera.Snap(g.camera.Target())
+	a.settled = true
+}
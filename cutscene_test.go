@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeAction takes a set number of frames and logs when it starts, so tests
+// can follow a cutscene without moving anyone around
+type fakeAction struct {
+	name   string
+	frames int
+	left   int
+	log    *[]string
+	frame  *int // The test's frame counter
+}
+
+func (a *fakeAction) Start(g *Game) {
+	a.left = a.frames
+	*a.log = append(*a.log, fmt.Sprintf("%d %s", *a.frame, a.name))
+}
+func (a *fakeAction) Update(g *Game) { a.left-- }
+func (a *fakeAction) Done() bool     { return a.left <= 0 }
+
+// cutsceneTest plays a cutscene frame by frame, counting from 1
+type cutsceneTest struct {
+	g     *Game
+	frame int
+	log   []string
+}
+
+func (ct *cutsceneTest) fake(name string, frames int) CutsceneAction {
+	return CutsceneAction{Action: &fakeAction{name: name, frames: frames, log: &ct.log, frame: &ct.frame}, WaitPrevious: true}
+}
+
+func step(a Action) CutsceneAction {
+	return CutsceneAction{Action: a, WaitPrevious: true}
+}
+
+func (ct *cutsceneTest) start(t *testing.T, tracks ...*Track) {
+	t.Helper()
+	if ct.g == nil {
+		ct.g = newTestGame(t)
+	}
+	c, err := NewCutscene(ct.g, tracks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct.g.Cutscene = c
+	ct.g.Cutscene.Start()
+}
+
+// play runs frames until the cutscene ends, at most limit of them, and
+// returns how many it took
+func (ct *cutsceneTest) play(limit int) int {
+	for ct.g.Cutscene.IsPlaying && ct.frame < limit {
+		ct.frame++
+		ct.g.Cutscene.Update()
+	}
+	return ct.frame
+}
+
+// Nothing else happens in the track during a wait of N frames, the next
+// action starts on the one after
+func TestCutsceneWait(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 10} {
+		ct := &cutsceneTest{}
+		ct.start(t, &Track{Name: "main", Actions: []CutsceneAction{
+			ct.fake("before", 0),
+			step(&WaitAction{Frames: n}),
+			ct.fake("after", 0),
+			step(&WaitAction{Frames: n}),
+			ct.fake("end", 0),
+		}})
+		ct.play(100)
+		want := []string{"1 before", fmt.Sprintf("%d after", 1+n), fmt.Sprintf("%d end", 1+2*n)}
+		if !reflect.DeepEqual(ct.log, want) {
+			t.Errorf("wait %d: log %q, want %q", n, ct.log, want)
+		}
+	}
+}
+
+func TestCutsceneJoin(t *testing.T) {
+	ct := &cutsceneTest{}
+	ct.start(t,
+		&Track{Name: "main", Actions: []CutsceneAction{
+			ct.fake("start", 1),
+			step(&JoinAction{Tracks: []string{"slow", "slower"}}),
+			ct.fake("joined", 0),
+		}},
+		&Track{Name: "slow", Actions: []CutsceneAction{ct.fake("slow", 5)}},
+		&Track{Name: "slower", Actions: []CutsceneAction{ct.fake("slower", 8)}},
+	)
+	ct.play(100)
+	// Tracks update in order, so main sees slower finish on the next frame
+	want := []string{"1 start", "1 slow", "1 slower", "9 joined"}
+	if !reflect.DeepEqual(ct.log, want) {
+		t.Errorf("log %q, want %q", ct.log, want)
+	}
+}
+
+// A goto with a condition only jumps when the GameProgress flags say so
+func TestCutsceneConditionalJump(t *testing.T) {
+	for _, met := range []bool{false, true} {
+		ct := &cutsceneTest{}
+		ct.start(t, &Track{Name: "main", Actions: []CutsceneAction{
+			step(&JumpAction{Label: "friends", If: func(g *Game) bool { return g.Progress.HasMetNPCBryan }}),
+			ct.fake("introduce", 2),
+			step(&LabelAction{Name: "friends"}),
+			ct.fake("chat", 1),
+		}})
+		ct.g.Progress.HasMetNPCBryan = met
+		ct.play(100)
+		want := []string{"1 introduce", "2 chat"}
+		if met {
+			want = []string{"1 chat"}
+		}
+		if !reflect.DeepEqual(ct.log, want) {
+			t.Errorf("HasMetNPCBryan %v: log %q, want %q", met, ct.log, want)
+		}
+	}
+}
+
+func TestCutsceneLoop(t *testing.T) {
+	ct := &cutsceneTest{}
+	ct.start(t, &Track{Name: "main", Actions: []CutsceneAction{
+		step(&LabelAction{Name: "top"}),
+		ct.fake("lap", 0),
+		step(&WaitAction{Frames: 2}),
+		step(&JumpAction{Label: "top", Count: 2}),
+		ct.fake("done", 0),
+	}})
+	ct.play(100)
+	want := []string{"1 lap", "3 lap", "5 lap", "7 done"}
+	if !reflect.DeepEqual(ct.log, want) {
+		t.Errorf("log %q, want %q", ct.log, want)
+	}
+}
+
+// A loop of actions that finish straight away gives up the frame after
+// maxGroupsPerFrame groups instead of hanging the game
+func TestCutsceneRunawayLoop(t *testing.T) {
+	ct := &cutsceneTest{}
+	ct.start(t, &Track{Name: "main", Actions: []CutsceneAction{
+		step(&LabelAction{Name: "top"}),
+		ct.fake("spin", 0),
+		step(&JumpAction{Label: "top"}),
+	}})
+	ct.play(1)
+	// Three groups a lap
+	if got, want := len(ct.log), maxGroupsPerFrame/3; got != want {
+		t.Errorf("spun %d times in a frame, want %d", got, want)
+	}
+	if !ct.g.Cutscene.IsPlaying {
+		t.Fatal("cutscene stopped")
+	}
+	ct.play(2)
+	if got, want := len(ct.log), 2*maxGroupsPerFrame/3; got < want-1 || got > want+1 {
+		t.Errorf("spun %d times in two frames, want about %d", got, want)
+	}
+}
+
+// The script commands build the same flow. A cutscene ends on the frame
+// after the last one it waits.
+func TestCutsceneScriptFlow(t *testing.T) {
+	tests := []struct {
+		src    string
+		met    bool
+		frames int // Waited
+	}{
+		{"label top\nwait 2\nloop top 3\n", false, 6},
+		{"goto end if HasMetNPCBryan\nwait 5\nlabel end\nwait 1\n", false, 6},
+		{"goto end if HasMetNPCBryan\nwait 5\nlabel end\nwait 1\n", true, 1},
+		{"goto end if !HasMetNPCBryan\nwait 5\nlabel end\nwait 1\n", true, 6},
+	}
+	for _, tt := range tests {
+		s, err := readTestScript(tt.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ct := &cutsceneTest{g: newTestGame(t)}
+		ct.g.Progress.HasMetNPCBryan = tt.met
+		c, err := s.Build(ct.g)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ct.g.Cutscene = c
+		ct.g.Cutscene.Start()
+		if frames := ct.play(100); frames != tt.frames+1 {
+			t.Errorf("%q with HasMetNPCBryan %v took %d frames, want %d", tt.src, tt.met, frames, tt.frames+1)
+		}
+	}
+}
+
+// Skipping a cutscene leaves things as playing it through would, even when
+// a track carries on after joining another
+func TestCutsceneSkipMatchesPlay(t *testing.T) {
+	build := func(ct *cutsceneTest) []*Track {
+		p := ct.g.player
+		return []*Track{
+			{Name: "main", Actions: []CutsceneAction{
+				step(&JoinAction{Tracks: []string{"slow"}}),
+				step(&TeleportAction{Actor: p, To: Vector2D{X: 100, Y: 40}}),
+				ct.fake("end", 0),
+			}},
+			{Name: "slow", Actions: []CutsceneAction{
+				step(&MoveAction{Actor: p, To: Vector2D{X: 30, Y: 60}}),
+				ct.fake("slow", 0),
+			}},
+		}
+	}
+	var ends [2]Vector2D
+	var logs [2][]string
+	for i, skip := range []bool{false, true} {
+		ct := &cutsceneTest{g: newTestGame(t)}
+		ct.start(t, build(ct)...)
+		if skip {
+			ct.g.Cutscene.Skip()
+		} else {
+			ct.play(100)
+		}
+		if ct.g.Cutscene.IsPlaying {
+			t.Fatalf("skip %v: cutscene still playing", skip)
+		}
+		ends[i] = Vector2D{X: ct.g.player.X, Y: ct.g.player.Y}
+		for _, l := range ct.log {
+			logs[i] = append(logs[i], l[strings.Index(l, " ")+1:])
+		}
+	}
+	if ends[1] != ends[0] {
+		t.Errorf("skipping leaves the player at %v, playing at %v", ends[1], ends[0])
+	}
+	if !reflect.DeepEqual(logs[1], logs[0]) {
+		t.Errorf("skipping ran %q, playing %q", logs[1], logs[0])
+	}
+}
+
+// Tracks joining each other in a circle, or looping forever, still skip
+func TestCutsceneSkipEnds(t *testing.T) {
+	ct := &cutsceneTest{}
+	ct.start(t,
+		&Track{Name: "main", Actions: []CutsceneAction{
+			step(&JoinAction{Tracks: []string{"other"}}),
+			ct.fake("main", 0),
+		}},
+		&Track{Name: "other", Actions: []CutsceneAction{
+			step(&JoinAction{Tracks: []string{"main"}}),
+			step(&LabelAction{Name: "top"}),
+			step(&WaitAction{Frames: 1}),
+			step(&JumpAction{Label: "top"}),
+		}},
+	)
+	ct.g.Cutscene.Skip()
+	if ct.g.Cutscene.IsPlaying {
+		t.Error("cutscene still playing")
+	}
+}
+
+// Skipping a conversation takes the first choice each time and applies the
+// effects on the way, so skipping Bryan's intro still agrees to the trip
+func TestCutsceneSkipDialogue(t *testing.T) {
+	ct := &cutsceneTest{}
+	ct.g = newTestGame(t)
+	tree := ct.g.dialogues.Get("Bryan", "trip")
+	if tree == nil {
+		t.Fatal("Bryan has no trip conversation")
+	}
+	ct.start(t, &Track{Name: "main", Actions: []CutsceneAction{step(&DialogueAction{Tree: tree}), ct.fake("after", 0)}})
+	ct.play(1)
+	if !ct.g.dialogue.IsOpen {
+		t.Fatal("dialogue didn't open")
+	}
+	ct.g.Cutscene.Skip()
+	p := &ct.g.Progress
+	if !p.Flag("AgreedToTrip") || p.Items["map"] != 1 {
+		t.Errorf("AgreedToTrip %v, %d maps after skipping", p.Flag("AgreedToTrip"), p.Items["map"])
+	}
+	if ct.g.dialogue.IsOpen || ct.g.Cutscene.IsPlaying {
+		t.Error("skipping left the dialogue or cutscene going")
+	}
+	if want := []string{"1 after"}; !reflect.DeepEqual(ct.log, want) {
+		t.Errorf("log %q, want %q", ct.log, want)
+	}
+}
@@ -0,0 +1,794 @@
+package main
+
+import (
+	"bufio"
+	"ebi/asset"
+	"ebi/richtext"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Directory that loadCutscenes scans for *.cut scripts
+const cutsceneDir = "cutscenes"
+
+// A cutscene script is a plain text file, one command per line. Blank lines
+// and everything after a # are ignored. The header lines say when it plays:
+//
+//	cutscene bryan_intro              name, defaults to the file name
+//	scene mainMapRed                  only play in this scene
+//	when HasMetNPCBryan !FirstCutSceneFinished
+//	                                  GameProgress flags that must be set (or not, with !).
+//	                                  Names other than its fields are kept in its Flags map.
+//	set FirstCutSceneFinished         flags set once the cutscene ends
+//	repeat                            allow playing more than once per session
+//
+// A script without a when line only plays when started with StartCutscene.
+// The other lines are steps, run one after the other. Starting a step with &
+// runs it alongside the step before it. Actors are "player" or an NPC name.
+//
+// Steps belong to the "main" track until a track line starts another one.
+// All tracks start together and the cutscene ends once they have all ended.
+//
+//	track NAME                        following steps go in a new track
+//	wait FRAMES                       do nothing for a while
+//	join TRACK [TRACK ...]            wait for other tracks to end
+//	label NAME                        a place to jump to within the track
+//	goto LABEL [if FLAG !FLAG ...]    jump, if the flags are (or aren't) set
+//	loop LABEL TIMES                  play from LABEL to here TIMES times in total
+//
+//	fadeout SPEED | fadein SPEED
+//	teleport ACTOR X Y
+//	move ACTOR X Y
+//	turn ACTOR up|down|left|right
+//	say "first line" "second line" ...
+//	talk NPC CONVERSATION             play one of the NPC's conversations, see DialogueDB
+//	pan ACTOR FRAMES | pan X Y FRAMES
+//	zoom LEVEL FRAMES
+//	shake INTENSITY FRAMES [wait]
+//	follow
+//	changescene SCENE X Y [up|down|left|right]
+//	                                  fades out and in by itself unless the
+//	                                  screen is already black
+//
+// Game code can add its own steps with RegisterAction.
+type CutsceneScript struct {
+	Name   string
+	Path   string
+	Scene  string
+	When   []scriptCondition
+	Sets   []string
+	Repeat bool
+	tracks []*scriptTrack
+}
+
+type scriptTrack struct {
+	name  string
+	line  int
+	steps []scriptStep
+}
+
+type scriptCondition struct {
+	Flag string
+	Want bool
+}
+
+type scriptStep struct {
+	line     int
+	parallel bool
+	build    ActionBuilder
+
+	// Filled in for flow steps so loadCutscenes can check them
+	label string
+	jump  string
+	joins []string
+}
+
+// ScriptEnv holds the names a script can refer to, so steps can be checked
+// while the script loads
+type ScriptEnv struct {
+	Actors    map[string]bool // NPCs placed in the scene files
+	Scenes    map[string]bool
+	Dialogues DialogueDB
+	Texts     []string // Lines the scripts say, to check their string IDs
+}
+
+// newScriptEnv describes the scenes and conversations scripts can refer to
+func newScriptEnv(defs map[string]*SceneFile, db DialogueDB) *ScriptEnv {
+	env := &ScriptEnv{Actors: make(map[string]bool), Scenes: make(map[string]bool), Dialogues: db}
+	for name, def := range defs {
+		env.Scenes[name] = true
+		for _, n := range def.NPCs {
+			env.Actors[n.Name] = true
+		}
+	}
+	return env
+}
+
+// CheckActor reports an error unless name is "player" or a known NPC
+func (e *ScriptEnv) CheckActor(name string) error {
+	if name != "player" && !e.Actors[name] {
+		return fmt.Errorf("unknown actor %q", name)
+	}
+	return nil
+}
+
+// CheckScene reports an error unless name is a known scene
+func (e *ScriptEnv) CheckScene(name string) error {
+	if !e.Scenes[name] {
+		return fmt.Errorf("unknown scene %q", name)
+	}
+	return nil
+}
+
+// CheckDialogue reports an error unless the NPC has a conversation with this id
+func (e *ScriptEnv) CheckDialogue(npcName, id string) error {
+	if e.Dialogues.Get(npcName, id) == nil {
+		return fmt.Errorf("%s has no conversation %q", npcName, id)
+	}
+	return nil
+}
+
+// ActionBuilder makes the action for a step when its cutscene is built.
+// scene is where the step will play, which changes after a changescene step.
+type ActionBuilder func(g *Game, scene string) (Action, error)
+
+// ActionParser reads the arguments of a step. Anything it can check without
+// a running game it should check here, so mistakes are reported with the
+// script's line number as soon as the game starts.
+type ActionParser func(args []string, env *ScriptEnv) (ActionBuilder, error)
+
+var actionParsers = map[string]ActionParser{
+	"fadeout":  parseFade(true),
+	"fadein":   parseFade(false),
+	"teleport": parseTeleport,
+	"move":     parseMove,
+	"turn":     parseTurn,
+	"say":      parseSay,
+	"talk":     parseTalk,
+	"pan":      parsePan,
+	"zoom":     parseZoom,
+	"shake":    parseShake,
+	"follow":   parseFollow,
+	"wait":     parseWait,
+
+	"changescene": parseChangeScene,
+}
+
+var scriptHeaders = map[string]bool{"cutscene": true, "scene": true, "when": true, "set": true, "repeat": true}
+
+// Commands handled by the script reader itself because they shape the tracks
+var scriptFlow = map[string]bool{"track": true, "label": true, "goto": true, "loop": true, "join": true}
+
+// RegisterAction adds a step command for cutscene scripts. Custom actions
+// have to be registered before the scripts are loaded in NewGame.
+func RegisterAction(name string, parse ActionParser) {
+	if _, ok := actionParsers[name]; ok || scriptHeaders[name] || scriptFlow[name] {
+		panic(fmt.Sprintf("cutscene command %q is already defined", name))
+	}
+	actionParsers[name] = parse
+}
+
+// loadCutscenes reads every script in dir. NPC names are checked against
+// actors and scene names against scenes.
+func loadCutscenes(assets *asset.Manager, dir string, env *ScriptEnv) ([]*CutsceneScript, error) {
+	paths, err := assets.Glob(path.Join(dir, "*.cut"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	var scripts []*CutsceneScript
+	names := make(map[string]string)
+	for _, path := range paths {
+		s, err := readCutsceneScript(assets, path, env)
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := names[s.Name]; ok {
+			return nil, fmt.Errorf("%s: cutscene %q is already defined in %s", path, s.Name, other)
+		}
+		names[s.Name] = path
+		scripts = append(scripts, s)
+	}
+	return scripts, nil
+}
+
+func readCutsceneScript(assets *asset.Manager, path string, env *ScriptEnv) (*CutsceneScript, error) {
+	f, err := assets.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s := &CutsceneScript{
+		Name: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+		Path: path,
+	}
+	s.tracks = []*scriptTrack{{name: "main"}}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if err := s.parseLine(scanner.Text(), line, env); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !s.hasSteps() {
+		return nil, fmt.Errorf("%s: cutscene has no steps", path)
+	}
+	if err := s.checkFlow(); err != nil {
+		return nil, fmt.Errorf("%s:%v", path, err)
+	}
+	return s, nil
+}
+
+// checkFlow makes sure every track has steps and every goto, loop and join
+// points at something that exists. Errors start with the line number.
+func (s *CutsceneScript) checkFlow() error {
+	tracks := make(map[string]bool)
+	for _, t := range s.tracks {
+		tracks[t.name] = true
+	}
+	for _, t := range s.tracks {
+		if len(t.steps) == 0 && t.name != "main" {
+			return fmt.Errorf("%d: track %s has no steps", t.line, t.name)
+		}
+		labels := make(map[string]bool)
+		for _, step := range t.steps {
+			if step.label == "" {
+				continue
+			}
+			if labels[step.label] {
+				return fmt.Errorf("%d: label %q is already defined in track %s", step.line, step.label, t.name)
+			}
+			labels[step.label] = true
+		}
+		for i, step := range t.steps {
+			if step.jump != "" && !labels[step.jump] {
+				return fmt.Errorf("%d: no label %q in track %s", step.line, step.jump, t.name)
+			}
+			if step.parallel && i > 0 && t.steps[i-1].jump != "" {
+				return fmt.Errorf("%d: a step can't run alongside a goto or loop", step.line)
+			}
+			for _, name := range step.joins {
+				if !tracks[name] {
+					return fmt.Errorf("%d: unknown track %q", step.line, name)
+				}
+				if name == t.name {
+					return fmt.Errorf("%d: track %s can't wait for itself", step.line, name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// hasSteps reports whether any step or track line has been read yet
+func (s *CutsceneScript) hasSteps() bool {
+	return len(s.tracks) > 1 || len(s.tracks[0].steps) > 0
+}
+
+func (s *CutsceneScript) addStep(step scriptStep) {
+	t := s.tracks[len(s.tracks)-1]
+	t.steps = append(t.steps, step)
+}
+
+func (s *CutsceneScript) parseLine(text string, line int, env *ScriptEnv) error {
+	toks, err := tokenizeScriptLine(text)
+	if err != nil {
+		return err
+	}
+	if len(toks) == 0 {
+		return nil
+	}
+	step := scriptStep{line: line}
+	if toks[0] == "&" {
+		step.parallel = true
+		toks = toks[1:]
+		if len(toks) == 0 {
+			return fmt.Errorf("& needs a step after it")
+		}
+	}
+	cmd, args := toks[0], toks[1:]
+
+	// Header lines
+	if scriptHeaders[cmd] {
+		if step.parallel {
+			return fmt.Errorf("%s can't run alongside another step", cmd)
+		}
+		if s.hasSteps() {
+			return fmt.Errorf("%s has to come before the first step", cmd)
+		}
+	}
+	switch cmd {
+	case "cutscene":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: cutscene NAME")
+		}
+		s.Name = args[0]
+		return nil
+	case "scene":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: scene NAME")
+		}
+		if err := env.CheckScene(args[0]); err != nil {
+			return err
+		}
+		s.Scene = args[0]
+		return nil
+	case "when":
+		if len(args) == 0 {
+			return fmt.Errorf("usage: when FLAG [!FLAG ...]")
+		}
+		s.When, err = parseConditions(args)
+		return err
+	case "set":
+		if len(args) == 0 {
+			return fmt.Errorf("usage: set FLAG [FLAG ...]")
+		}
+		for _, a := range args {
+			if err := checkFlagName(a); err != nil {
+				return err
+			}
+		}
+		s.Sets = append(s.Sets, args...)
+		return nil
+	case "repeat":
+		if len(args) != 0 {
+			return fmt.Errorf("usage: repeat")
+		}
+		s.Repeat = true
+		return nil
+	}
+
+	// Track flow
+	if scriptFlow[cmd] {
+		if step.parallel && cmd != "join" {
+			return fmt.Errorf("%s can't run alongside another step", cmd)
+		}
+	}
+	switch cmd {
+	case "track":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: track NAME")
+		}
+		for _, t := range s.tracks {
+			if t.name == args[0] {
+				return fmt.Errorf("track %s is already defined", args[0])
+			}
+		}
+		s.tracks = append(s.tracks, &scriptTrack{name: args[0], line: line})
+		return nil
+	case "label":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: label NAME")
+		}
+		step.label = args[0]
+		step.build = func(g *Game, scene string) (Action, error) {
+			return &LabelAction{Name: args[0]}, nil
+		}
+	case "goto":
+		if len(args) == 0 || (len(args) > 1 && (args[1] != "if" || len(args) == 2)) {
+			return fmt.Errorf("usage: goto LABEL [if FLAG !FLAG ...]")
+		}
+		var conds []scriptCondition
+		if len(args) > 2 {
+			if conds, err = parseConditions(args[2:]); err != nil {
+				return err
+			}
+		}
+		step.jump = args[0]
+		step.build = func(g *Game, scene string) (Action, error) {
+			a := &JumpAction{Label: args[0]}
+			if len(conds) > 0 {
+				a.If = func(g *Game) bool { return conditionsHold(g, conds) }
+			}
+			return a, nil
+		}
+	case "loop":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: loop LABEL TIMES")
+		}
+		times, err := strconv.Atoi(args[1])
+		if err != nil || times < 2 {
+			return fmt.Errorf("expected a loop count of 2 or more, got %q", args[1])
+		}
+		step.jump = args[0]
+		step.build = func(g *Game, scene string) (Action, error) {
+			return &JumpAction{Label: args[0], Count: times - 1}, nil
+		}
+	case "join":
+		if len(args) == 0 {
+			return fmt.Errorf("usage: join TRACK [TRACK ...]")
+		}
+		step.joins = args
+		step.build = func(g *Game, scene string) (Action, error) {
+			return &JoinAction{Tracks: args}, nil
+		}
+	default:
+		// Steps
+		parse, ok := actionParsers[cmd]
+		if !ok {
+			return fmt.Errorf("unknown command %q", cmd)
+		}
+		if step.build, err = parse(args, env); err != nil {
+			return err
+		}
+	}
+	s.addStep(step)
+	return nil
+}
+
+// Build turns the script into a cutscene for the current scene, looking up
+// the actors it names.
+func (s *CutsceneScript) Build(g *Game) (Cutscene, error) {
+	var tracks []*Track
+	for _, st := range s.tracks {
+		t := &Track{Name: st.name}
+		scene := g.CurrentScene
+		for _, step := range st.steps {
+			a, err := step.build(g, scene)
+			if err == nil {
+				err = validateAction(g, a)
+			}
+			if err != nil {
+				return Cutscene{}, fmt.Errorf("%s:%d: %v", s.Path, step.line, err)
+			}
+			if cs, ok := a.(*ChangeSceneAction); ok {
+				// Later steps happen in the new scene, so its NPCs have to exist
+				// before they can be looked up
+				scene = cs.Scene
+				g.Scenes[scene].loadNPCs(g)
+			}
+			t.Actions = append(t.Actions, CutsceneAction{Action: a, WaitPrevious: !step.parallel})
+		}
+		tracks = append(tracks, t)
+	}
+	c, err := NewCutscene(g, tracks)
+	if err != nil {
+		return Cutscene{}, fmt.Errorf("%s: %v", s.Path, err)
+	}
+	c.CleanUp = func(c *Cutscene) {
+		c.IsPlaying = false
+		for _, flag := range s.Sets {
+			c.Game.Progress.SetFlag(flag, true)
+		}
+		c.Game.state = PlayState
+	}
+	return c, nil
+}
+
+// Triggered reports whether the script should start playing now
+func (s *CutsceneScript) Triggered(g *Game) bool {
+	if len(s.When) == 0 {
+		return false
+	}
+	if s.Scene != "" && s.Scene != g.CurrentScene {
+		return false
+	}
+	if !s.Repeat && g.playedCutscenes[s.Name] {
+		return false
+	}
+	return conditionsHold(g, s.When)
+}
+
+// parseConditions reads a list of GameProgress flags, each optionally
+// negated with !
+func parseConditions(args []string) ([]scriptCondition, error) {
+	var conds []scriptCondition
+	for _, a := range args {
+		c := scriptCondition{Flag: strings.TrimPrefix(a, "!"), Want: !strings.HasPrefix(a, "!")}
+		if err := checkFlagName(c.Flag); err != nil {
+			return nil, err
+		}
+		conds = append(conds, c)
+	}
+	return conds, nil
+}
+
+func conditionsHold(g *Game, conds []scriptCondition) bool {
+	for _, c := range conds {
+		if g.Progress.Flag(c.Flag) != c.Want {
+			return false
+		}
+	}
+	return true
+}
+
+// findActor returns the player or the NPC with the given name in a scene
+func (g *Game) findActor(scene, name string) (Actor, error) {
+	if name == "player" {
+		return g.player, nil
+	}
+	for _, n := range g.Scenes[scene].NPCs {
+		if n.Name == name {
+			return n, nil
+		}
+	}
+	return nil, fmt.Errorf("%s is not in scene %s", name, scene)
+}
+
+// checkFlagName accepts the names of GameProgress's bool fields and any other
+// single word, which is kept in GameProgress.Flags
+func checkFlagName(name string) error {
+	if name == "" || strings.ContainsAny(name, "! \t\"") {
+		return fmt.Errorf("bad flag name %q", name)
+	}
+	return nil
+}
+
+func parseFade(out bool) ActionParser {
+	return func(args []string, env *ScriptEnv) (ActionBuilder, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("usage: fadeout|fadein SPEED")
+		}
+		speed, err := parsePositive(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return func(g *Game, scene string) (Action, error) {
+			return &FadeAction{Out: out, Speed: speed}, nil
+		}, nil
+	}
+}
+
+// actorBuilder looks the actor up when the cutscene is built and hands it to fn
+func actorBuilder(name string, fn func(a Actor) Action) ActionBuilder {
+	return func(g *Game, scene string) (Action, error) {
+		a, err := g.findActor(scene, name)
+		if err != nil {
+			return nil, err
+		}
+		return fn(a), nil
+	}
+}
+
+func parseTeleport(args []string, env *ScriptEnv) (ActionBuilder, error) {
+	if len(args) != 3 {
+		return nil, fmt.Errorf("usage: teleport ACTOR X Y")
+	}
+	if err := env.CheckActor(args[0]); err != nil {
+		return nil, err
+	}
+	to, err := parsePos(args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+	return actorBuilder(args[0], func(a Actor) Action {
+		return &TeleportAction{Actor: a, To: to}
+	}), nil
+}
+
+func parseMove(args []string, env *ScriptEnv) (ActionBuilder, error) {
+	if len(args) != 3 {
+		return nil, fmt.Errorf("usage: move ACTOR X Y")
+	}
+	if err := env.CheckActor(args[0]); err != nil {
+		return nil, err
+	}
+	to, err := parsePos(args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+	return actorBuilder(args[0], func(a Actor) Action {
+		return &MoveAction{Actor: a, To: to}
+	}), nil
+}
+
+func parseTurn(args []string, env *ScriptEnv) (ActionBuilder, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("usage: turn ACTOR DIRECTION")
+	}
+	if err := env.CheckActor(args[0]); err != nil {
+		return nil, err
+	}
+	if err := checkDirection(args[1]); err != nil {
+		return nil, err
+	}
+	return actorBuilder(args[0], func(a Actor) Action {
+		return &TurnAction{Actor: a, Direction: args[1]}
+	}), nil
+}
+
+func parseSay(args []string, env *ScriptEnv) (ActionBuilder, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("usage: say \"LINE\" [\"LINE\" ...]")
+	}
+	for _, line := range args {
+		if _, err := richtext.Parse(line); err != nil {
+			return nil, err
+		}
+	}
+	env.Texts = append(env.Texts, args...)
+	return func(g *Game, scene string) (Action, error) {
+		return &DialogueAction{Lines: args}, nil
+	}, nil
+}
+
+func parseTalk(args []string, env *ScriptEnv) (ActionBuilder, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("usage: talk NPC CONVERSATION")
+	}
+	if err := env.CheckDialogue(args[0], args[1]); err != nil {
+		return nil, err
+	}
+	return func(g *Game, scene string) (Action, error) {
+		return &DialogueAction{Tree: g.dialogues.Get(args[0], args[1])}, nil
+	}, nil
+}
+
+func parsePan(args []string, env *ScriptEnv) (ActionBuilder, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, fmt.Errorf("usage: pan ACTOR FRAMES or pan X Y FRAMES")
+	}
+	frames, err := parseFrames(args[len(args)-1])
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 2 {
+		if err := env.CheckActor(args[0]); err != nil {
+			return nil, err
+		}
+		return actorBuilder(args[0], func(a Actor) Action {
+			return &PanAction{Target: a, Frames: frames}
+		}), nil
+	}
+	to, err := parsePos(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	return func(g *Game, scene string) (Action, error) {
+		return &PanAction{To: to, Frames: frames}, nil
+	}, nil
+}
+
+func parseZoom(args []string, env *ScriptEnv) (ActionBuilder, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("usage: zoom LEVEL FRAMES")
+	}
+	zoom, err := parsePositive(args[0])
+	if err != nil {
+		return nil, err
+	}
+	frames, err := parseFrames(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return func(g *Game, scene string) (Action, error) {
+		return &ZoomAction{Zoom: zoom, Frames: frames}, nil
+	}, nil
+}
+
+func parseShake(args []string, env *ScriptEnv) (ActionBuilder, error) {
+	if len(args) != 2 && !(len(args) == 3 && args[2] == "wait") {
+		return nil, fmt.Errorf("usage: shake INTENSITY FRAMES [wait]")
+	}
+	intensity, err := parsePositive(args[0])
+	if err != nil {
+		return nil, err
+	}
+	frames, err := parseFrames(args[1])
+	if err != nil {
+		return nil, err
+	}
+	wait := len(args) == 3
+	return func(g *Game, scene string) (Action, error) {
+		return &ShakeAction{Intensity: intensity, Frames: frames, Wait: wait}, nil
+	}, nil
+}
+
+func parseChangeScene(args []string, env *ScriptEnv) (ActionBuilder, error) {
+	if len(args) != 3 && len(args) != 4 {
+		return nil, fmt.Errorf("usage: changescene SCENE X Y [DIRECTION]")
+	}
+	if err := env.CheckScene(args[0]); err != nil {
+		return nil, err
+	}
+	spawn, err := parsePos(args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+	dir := ""
+	if len(args) == 4 {
+		if err := checkDirection(args[3]); err != nil {
+			return nil, err
+		}
+		dir = args[3]
+	}
+	return func(g *Game, scene string) (Action, error) {
+		return &ChangeSceneAction{Scene: args[0], Spawn: spawn, Direction: dir}, nil
+	}, nil
+}
+
+func parseWait(args []string, env *ScriptEnv) (ActionBuilder, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("usage: wait FRAMES")
+	}
+	frames, err := parseFrames(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return func(g *Game, scene string) (Action, error) {
+		return &WaitAction{Frames: frames}, nil
+	}, nil
+}
+
+func parseFollow(args []string, env *ScriptEnv) (ActionBuilder, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf("usage: follow")
+	}
+	return func(g *Game, scene string) (Action, error) {
+		return &FollowAction{}, nil
+	}, nil
+}
+
+func parsePos(xs, ys string) (Vector2D, error) {
+	x, err := strconv.ParseFloat(xs, 64)
+	if err != nil {
+		return Vector2D{}, fmt.Errorf("bad x %q", xs)
+	}
+	y, err := strconv.ParseFloat(ys, 64)
+	if err != nil {
+		return Vector2D{}, fmt.Errorf("bad y %q", ys)
+	}
+	return Vector2D{X: x, Y: y}, nil
+}
+
+func parsePositive(s string) (float64, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f <= 0 {
+		return 0, fmt.Errorf("expected a positive number, got %q", s)
+	}
+	return f, nil
+}
+
+func parseFrames(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("expected a number of frames, got %q", s)
+	}
+	return n, nil
+}
+
+// tokenizeScriptLine splits a line on spaces, keeping "quoted strings" whole
+func tokenizeScriptLine(line string) ([]string, error) {
+	var toks []string
+	for i := 0; i < len(line); {
+		switch c := line[i]; {
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == '#':
+			return toks, nil
+		case c == '"':
+			j := i + 1
+			for j < len(line) && line[j] != '"' {
+				if line[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(line) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			s, err := strconv.Unquote(line[i : j+1])
+			if err != nil {
+				return nil, fmt.Errorf("bad string %s", line[i:j+1])
+			}
+			toks = append(toks, s)
+			i = j + 1
+		default:
+			j := i
+			for j < len(line) && line[j] != ' ' && line[j] != '\t' && line[j] != '\r' {
+				j++
+			}
+			toks = append(toks, line[i:j])
+			i = j
+		}
+	}
+	return toks, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"ebi/asset"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func testScriptEnv() *ScriptEnv {
+	return &ScriptEnv{
+		Actors:    map[string]bool{"Bryan": true},
+		Scenes:    map[string]bool{"mainMap": true, "mainMapRed": true},
+		Dialogues: DialogueDB{"Bryan": {{ID: "trip"}}},
+	}
+}
+
+func readTestScript(src string) (*CutsceneScript, error) {
+	assets := asset.New(fstest.MapFS{"test.cut": {Data: []byte(src)}})
+	return readCutsceneScript(assets, "test.cut", testScriptEnv())
+}
+
+func TestCutsceneScript(t *testing.T) {
+	s, err := readTestScript(`# Comments and blank lines are fine
+cutscene intro
+scene mainMapRed
+when HasMetNPCBryan !FirstCutSceneFinished
+set FirstCutSceneFinished
+
+teleport player 10 20
+move Bryan 30 40   # Trailing comment
+& say "Hi # not a comment"
+pan Bryan 30
+track camera
+label top
+wait 5
+loop top 3
+join main
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "intro" || s.Scene != "mainMapRed" || len(s.When) != 2 || s.When[1].Want || len(s.Sets) != 1 {
+		t.Errorf("header read as %+v", s)
+	}
+	if len(s.tracks) != 2 || len(s.tracks[0].steps) != 4 || len(s.tracks[1].steps) != 4 {
+		t.Fatalf("got %d tracks", len(s.tracks))
+	}
+	if step := s.tracks[0].steps[2]; !step.parallel || step.line != 9 {
+		t.Errorf("say step is %+v, want parallel on line 9", step)
+	}
+}
+
+// Errors say which line of the script is wrong
+func TestCutsceneScriptErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		err  string
+	}{
+		{"unknown actor", "fadein 1\nmove Alice 1 2\n", `test.cut:2: unknown actor "Alice"`},
+		{"unknown action", "\n\n# Nothing yet\ndance player\n", `test.cut:4: unknown command "dance"`},
+		{"bad move", "move player 1\n", "test.cut:1: usage: move ACTOR X Y"},
+		{"bad number", "fadein 1\nmove player one 2\n", `test.cut:2: bad x "one"`},
+		{"bad turn", "turn player sideways\n", `test.cut:1: unknown direction "sideways"`},
+		{"unknown scene", "scene town\n", `test.cut:1: unknown scene "town"`},
+		{"unknown changescene", "changescene town 1 2\n", `test.cut:1: unknown scene "town"`},
+		{"unknown conversation", "talk Bryan weather\n", `test.cut:1: Bryan has no conversation "weather"`},
+		{"unterminated string", "fadein 1\nsay \"Hello there\n", "test.cut:2: unterminated string"},
+		{"header after steps", "fadein 1\nscene mainMap\n", "test.cut:2: scene has to come before the first step"},
+		{"empty track", "wait 1\ntrack camera\n", "test.cut:2: track camera has no steps"},
+		{"unknown label", "wait 1\nlabel top\nwait 1\ngoto bottom\n", `test.cut:4: no label "bottom" in track main`},
+		{"loop count", "label top\nwait 1\nloop top 1\n", `test.cut:3: expected a loop count of 2 or more, got "1"`},
+		{"unknown track", "wait 1\njoin camera\n", `test.cut:2: unknown track "camera"`},
+		{"dangling &", "fadein 1\n&\n", "test.cut:2: & needs a step after it"},
+		{"no steps", "cutscene empty\n", "test.cut: cutscene has no steps"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readTestScript(tt.src)
+			if err == nil {
+				t.Fatalf("no error, want %q", tt.err)
+			}
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got %q, want %q", err, tt.err)
+			}
+		})
+	}
+}
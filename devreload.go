@@ -0,0 +1,175 @@
+package main
+
+import (
+	"ebi/npc"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// How often dev mode looks for changed files, in frames
+const devPollFrames = 30
+
+// Directories dev mode watches for changes
+var devWatchDirs = []string{"assets", cutsceneDir, dialogueDir, langDir, sceneDir}
+
+// startDevMode makes the game reload its files when they change on disk, see
+// hotReload
+func (g *Game) startDevMode() {
+	if gameFS != nil {
+		log.Println("dev mode needs the files on disk, not embedded")
+		return
+	}
+	g.watcher = g.assets.Watch(devWatchDirs...)
+}
+
+// hotReload looks for changed files every so often and reloads whatever they
+// affect, leaving the player where they are. It waits while a cutscene or a
+// conversation is going, since those hold on to the actors and dialogue that
+// would be replaced. Broken files are reported and the old content kept.
+func (g *Game) hotReload() {
+	if g.watcher == nil {
+		return
+	}
+	g.devFrames++
+	if g.devFrames < devPollFrames || (g.state != PlayState && g.state != MenuState) || g.dialogue.IsOpen {
+		return
+	}
+	g.devFrames = 0
+	changed, err := g.watcher.Poll()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	var lang, scenes, sprites, cutscenes bool
+	for _, name := range changed {
+		log.Printf("%s changed", name)
+		switch {
+		case name == palettePath:
+			if err := g.reloadPalettes(); err != nil {
+				log.Println(err)
+				continue
+			}
+			// Recolour everything
+			sprites, scenes = true, true
+		case strings.HasPrefix(name, langDir+"/"):
+			lang = true
+		case strings.HasPrefix(name, dialogueDir+"/"), strings.HasPrefix(name, cutsceneDir+"/"):
+			cutscenes = true
+		case strings.HasPrefix(name, "assets/player"):
+			sprites = true
+		case strings.HasPrefix(name, "assets/portrait"):
+			// Portraits are looked up for every line, the watcher already
+			// dropped the cached one
+		default:
+			// Scene files and the images and tilesets they draw
+			scenes = true
+		}
+	}
+	if lang {
+		if err := g.reloadLocale(); err != nil {
+			log.Println(err)
+		}
+	}
+	if scenes {
+		if err := g.reloadScenes(); err != nil {
+			log.Println(err)
+		}
+		// Speakers and cutscene actors come from the scene files
+		cutscenes = true
+	}
+	if sprites {
+		if err := g.reloadSprites(); err != nil {
+			log.Println(err)
+		}
+	}
+	if cutscenes {
+		if err := g.loadCutscenes(); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// reloadPalettes reads the palettes again and drops the images recoloured with
+// the old ones
+func (g *Game) reloadPalettes() error {
+	palettes, err := loadPalettes(g.assets)
+	if err != nil {
+		return err
+	}
+	g.palettes = palettes
+	g.assets.ForgetRecolored()
+	return nil
+}
+
+// reloadLocale reads the string tables again, staying in the same language
+func (g *Game) reloadLocale() error {
+	tag := g.locale.Language()
+	if err := g.loadLocale(); err != nil {
+		return err
+	}
+	g.locale.SetLanguage(tag)
+	return nil
+}
+
+// reloadScenes reads the scene files again and sets up the current scene's
+// obstacles and doors from scratch. NPCs that were already placed keep their
+// position and whatever they were doing, so editing a scene doesn't send
+// everyone back to the start. Other scenes are set up when the player next
+// enters them.
+func (g *Game) reloadScenes() error {
+	old := g.Scenes
+	if err := g.loadScenes(); err != nil {
+		return err
+	}
+	if g.Scenes[g.CurrentScene] == nil {
+		g.Scenes = old
+		return fmt.Errorf("scene %q is gone, keeping the old scenes", g.CurrentScene)
+	}
+	g.loadSpeakers()
+	g.Scenes[g.CurrentScene].loadObsnDoors(g)
+	g.Scenes[g.CurrentScene].loadNPCs(g)
+	for name, s := range g.Scenes {
+		if o := old[name]; o != nil && len(o.NPCs) > 0 {
+			s.loadNPCs(g)
+			keepNPCs(o.NPCs, s.NPCs)
+		}
+	}
+	return nil
+}
+
+// keepNPCs carries the position and state of NPCs over from before a reload,
+// matching them by name. NPCs new to the scene file start where it says.
+func keepNPCs(old, now []*npc.NPC) {
+	for _, n := range now {
+		for _, o := range old {
+			if o.Name != n.Name {
+				continue
+			}
+			n.X, n.Y, n.Direction = o.X, o.Y, o.Direction
+			n.MoveTimer, n.StopTimer, n.IsStopped, n.StopDuration = o.MoveTimer, o.StopTimer, o.IsStopped, o.StopDuration
+			n.InteractionState = o.InteractionState
+			break
+		}
+	}
+}
+
+// reloadSprites gives the player and every NPC their animation again
+func (g *Game) reloadSprites() error {
+	a, err := loadAnimation(g.assets, g.palettes, g.player.Skin)
+	if err != nil {
+		return err
+	}
+	g.player.Anim.SetAnimation(a)
+	for _, s := range g.Scenes {
+		for _, n := range s.NPCs {
+			a, err := loadAnimation(g.assets, g.palettes, n.Skin)
+			if err != nil {
+				return err
+			}
+			n.Anim.SetAnimation(a)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"ebi/npc"
+	"testing"
+)
+
+func TestKeepNPCs(t *testing.T) {
+	old := []*npc.NPC{
+		{Name: "Bryan", X: 100, Y: 200, Direction: "left", IsStopped: true, StopTimer: 30, InteractionState: npc.WaitingForPlayerToResume},
+		{Name: "Gone", X: 1, Y: 2},
+	}
+	now := []*npc.NPC{
+		{Name: "Newcomer", X: 5, Y: 6, Direction: "down"},
+		{Name: "Bryan", X: 450, Y: 250, Direction: "down"},
+	}
+	keepNPCs(old, now)
+	b := now[1]
+	if b.X != 100 || b.Y != 200 || b.Direction != "left" || !b.IsStopped || b.StopTimer != 30 || b.InteractionState != npc.WaitingForPlayerToResume {
+		t.Errorf("Bryan after the reload: %+v", b)
+	}
+	if n := now[0]; n.X != 5 || n.Y != 6 || n.Direction != "down" {
+		t.Errorf("newcomer moved to %+v", n)
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"ebi/asset"
+	"ebi/richtext"
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Directory that loadDialogueDB scans for conversations, one file per NPC
+const dialogueDir = "dialogues"
+
+// DialogueDB holds every NPC's conversations, keyed by NPC name. The file
+// dialogues/Bryan.json holds Bryan's:
+//
+//	{"conversations": [
+//		{"id": "trip", "scripted": true, "start": "ask", "nodes": {...}},
+//		{"id": "red_town", "when": ["HasVisitedRedTown"], "start": ..., "nodes": ...},
+//		{"id": "greeting", "start": ..., "nodes": ...}
+//	]}
+//
+// Talking to an NPC plays the first of its conversations whose conditions
+// hold, so more specific ones go first. Scripted conversations are only
+// played by cutscenes. Text and choices are usually string IDs such as
+// "@bryan.ready", see package locale.
+type DialogueDB map[string][]*Conversation
+
+type Conversation struct {
+	ID       string   `json:"id"`
+	When     []string `json:"when,omitempty"`
+	Scripted bool     `json:"scripted,omitempty"`
+	DialogueTree
+}
+
+type dialogueFile struct {
+	Conversations []*Conversation `json:"conversations"`
+}
+
+// DialogueTree is a conversation made of nodes. Each node shows its text,
+// then the conversation moves on to the choice the player picks, or to the
+// first branch whose conditions hold, or to Next. A node without anywhere to
+// go ends the conversation.
+//
+// Conditions are lists of GameProgress flags, each one optionally negated
+// with a leading !, that must all hold.
+type DialogueTree struct {
+	Name  string                   `json:"-"` // NPC/id, for error messages
+	Start string                   `json:"start"`
+	Nodes map[string]*DialogueNode `json:"nodes"`
+}
+
+type DialogueNode struct {
+	Speaker    string           `json:"speaker,omitempty"`    // NPC name or "player", for lines that don't say
+	Expression string           `json:"expression,omitempty"` // Portrait for lines that don't say, see portrait.go
+	Text       []DialogueLine   `json:"text,omitempty"`       // Shown one line at a time, a node without text moves straight on
+	Choices    []DialogueChoice `json:"choices,omitempty"`
+	Branches   []DialogueBranch `json:"branches,omitempty"`
+	Next       string           `json:"next,omitempty"`
+	Effects    DialogueEffects  `json:"effects,omitempty"` // Applied when the node is reached
+}
+
+// DialogueLine is a line of text, written in the files either as a plain
+// string or as {"speaker": "Bryan", "expression": "happy", "text": "..."}
+// when it needs its own speaker or expression
+type DialogueLine struct {
+	Speaker    string `json:"speaker,omitempty"`
+	Expression string `json:"expression,omitempty"`
+	Text       string `json:"text"`
+}
+
+func (l *DialogueLine) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		*l = DialogueLine{}
+		return json.Unmarshal(data, &l.Text)
+	}
+	type line DialogueLine // Without this method
+	return json.Unmarshal(data, (*line)(l))
+}
+
+// line returns the i'th line with the node's speaker and expression filled in
+func (n *DialogueNode) line(i int) DialogueLine {
+	l := n.Text[i]
+	if l.Speaker == "" {
+		l.Speaker = n.Speaker
+		if l.Expression == "" {
+			l.Expression = n.Expression
+		}
+	}
+	return l
+}
+
+type DialogueChoice struct {
+	Text string   `json:"text"`
+	Next string   `json:"next,omitempty"` // Empty ends the conversation
+	If   []string `json:"if,omitempty"`   // The choice is hidden unless these hold
+}
+
+type DialogueBranch struct {
+	If   []string `json:"if"`
+	Next string   `json:"next"`
+}
+
+type DialogueEffects struct {
+	Set      []string `json:"set,omitempty"`      // Flags to set
+	Clear    []string `json:"clear,omitempty"`    // Flags to clear
+	Give     []string `json:"give,omitempty"`     // Items added to GameProgress.Items
+	Cutscene string   `json:"cutscene,omitempty"` // Played once the conversation ends
+}
+
+// LinesTree makes a conversation that shows some lines and ends, for NPCs and
+// cutscenes that don't need choices
+func LinesTree(speaker string, lines []string) *DialogueTree {
+	text := make([]DialogueLine, len(lines))
+	for i, l := range lines {
+		text[i] = DialogueLine{Text: l}
+	}
+	return &DialogueTree{
+		Start: "start",
+		Nodes: map[string]*DialogueNode{"start": {Speaker: speaker, Text: text}},
+	}
+}
+
+// loadDialogueDB reads every *.json file in dir, named after the NPC whose
+// conversations it holds
+func loadDialogueDB(assets *asset.Manager, dir string) (DialogueDB, error) {
+	paths, err := assets.Glob(path.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	db := make(DialogueDB)
+	for _, path := range paths {
+		data, err := assets.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var f dialogueFile
+		if err := json.Unmarshal(data, &f); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		npcName := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		ids := make(map[string]bool)
+		for _, c := range f.Conversations {
+			if c.ID == "" || ids[c.ID] {
+				return nil, fmt.Errorf("%s: conversations need a unique id, got %q", path, c.ID)
+			}
+			ids[c.ID] = true
+			if _, err := parseConditions(c.When); err != nil {
+				return nil, fmt.Errorf("%s: conversation %s: %v", path, c.ID, err)
+			}
+			c.Name = npcName + "/" + c.ID
+			if err := c.validate(); err != nil {
+				return nil, fmt.Errorf("%s: conversation %s: %v", path, c.ID, err)
+			}
+		}
+		db[npcName] = f.Conversations
+	}
+	return db, nil
+}
+
+// Get returns an NPC's conversation by id, or nil
+func (db DialogueDB) Get(npcName, id string) *DialogueTree {
+	for _, c := range db[npcName] {
+		if c.ID == id {
+			return &c.DialogueTree
+		}
+	}
+	return nil
+}
+
+// Pick returns the conversation an NPC has for the player right now, or nil
+// if none of them fit
+func (db DialogueDB) Pick(g *Game, npcName string) *DialogueTree {
+	for _, c := range db[npcName] {
+		if !c.Scripted && holds(g, c.When) {
+			return &c.DialogueTree
+		}
+	}
+	return nil
+}
+
+// checkCutscenes makes sure every cutscene the conversations start exists
+func (db DialogueDB) checkCutscenes(cutscenes []*CutsceneScript) error {
+	for _, convs := range db {
+		for _, c := range convs {
+			if err := c.checkCutscenes(cutscenes); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validate checks that every node the tree points at exists and every
+// condition names a flag
+func (t *DialogueTree) validate() error {
+	if t.Nodes[t.Start] == nil {
+		return fmt.Errorf("start node %q does not exist", t.Start)
+	}
+	checkNext := func(id, next string) error {
+		if next != "" && t.Nodes[next] == nil {
+			return fmt.Errorf("node %s: next node %q does not exist", id, next)
+		}
+		return nil
+	}
+	ids := make([]string, 0, len(t.Nodes))
+	for id := range t.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		n := t.Nodes[id]
+		if n == nil {
+			return fmt.Errorf("node %s is empty", id)
+		}
+		for _, line := range n.Text {
+			if _, err := richtext.Parse(line.Text); err != nil {
+				return fmt.Errorf("node %s: %v", id, err)
+			}
+		}
+		if len(n.Text) == 0 && len(n.Choices) > 0 {
+			return fmt.Errorf("node %s: choices need some text to go with them", id)
+		}
+		if len(n.Choices) > 0 && (len(n.Branches) > 0 || n.Next != "") {
+			return fmt.Errorf("node %s: a node with choices can't have branches or next", id)
+		}
+		for _, c := range n.Choices {
+			if err := checkNext(id, c.Next); err != nil {
+				return err
+			}
+			if _, err := parseConditions(c.If); err != nil {
+				return fmt.Errorf("node %s: %v", id, err)
+			}
+		}
+		for _, b := range n.Branches {
+			if err := checkNext(id, b.Next); err != nil {
+				return err
+			}
+			if _, err := parseConditions(b.If); err != nil {
+				return fmt.Errorf("node %s: %v", id, err)
+			}
+		}
+		if err := checkNext(id, n.Next); err != nil {
+			return err
+		}
+		for _, f := range append(append([]string{}, n.Effects.Set...), n.Effects.Clear...) {
+			if err := checkFlagName(f); err != nil {
+				return fmt.Errorf("node %s: %v", id, err)
+			}
+		}
+	}
+	return nil
+}
+
+// checkCutscenes makes sure every cutscene the tree starts exists
+func (t *DialogueTree) checkCutscenes(cutscenes []*CutsceneScript) error {
+	for id, n := range t.Nodes {
+		name := n.Effects.Cutscene
+		if name == "" {
+			continue
+		}
+		found := false
+		for _, c := range cutscenes {
+			found = found || c.Name == name
+		}
+		if !found {
+			return fmt.Errorf("dialogue %s, node %s: unknown cutscene %q", t.Name, id, name)
+		}
+	}
+	return nil
+}
+
+// holds reports whether a list of conditions, already checked by validate,
+// holds right now
+func holds(g *Game, conds []string) bool {
+	cs, _ := parseConditions(conds)
+	return conditionsHold(g, cs)
+}
+
+func (e DialogueEffects) apply(g *Game) {
+	for _, f := range e.Set {
+		g.Progress.SetFlag(f, true)
+	}
+	for _, f := range e.Clear {
+		g.Progress.SetFlag(f, false)
+	}
+	for _, item := range e.Give {
+		if g.Progress.Items == nil {
+			g.Progress.Items = make(map[string]int)
+		}
+		g.Progress.Items[item]++
+	}
+	if e.Cutscene != "" {
+		g.cutsceneQueue = append(g.cutsceneQueue, e.Cutscene)
+	}
+}
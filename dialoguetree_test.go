@@ -0,0 +1,255 @@
+package main
+
+import (
+	"ebi/asset"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+// testTree asks the player along, with a secret answer for friends and a
+// goodbye that depends on the flags
+func testTree() *DialogueTree {
+	return &DialogueTree{Start: "ask", Nodes: map[string]*DialogueNode{
+		"ask": {Text: []DialogueLine{{Text: "Hi"}, {Text: "Coming along?"}}, Choices: []DialogueChoice{
+			{Text: "Yes", Next: "yes"},
+			{Text: "No", Next: "no"},
+			{Text: "Psst", Next: "secret", If: []string{"Friends"}},
+		}},
+		"yes":    {Text: []DialogueLine{{Text: "Great"}}, Next: "bye", Effects: DialogueEffects{Set: []string{"Agreed"}, Give: []string{"map"}}},
+		"no":     {Text: []DialogueLine{{Text: "Oh"}}, Effects: DialogueEffects{Clear: []string{"Agreed"}}},
+		"secret": {Text: []DialogueLine{{Text: "Shh"}}, Next: "yes"},
+		"bye": {Branches: []DialogueBranch{
+			{If: []string{"!Friends"}, Next: ""},
+			{If: []string{"Friends", "HasVisitedRedTown"}, Next: "again"},
+		}, Next: "friend"},
+		"friend": {Text: []DialogueLine{{Text: "See you, friend"}}},
+		"again":  {Text: []DialogueLine{{Text: "Back to Red Town?"}}},
+	}}
+}
+
+// talk plays a conversation, taking the given choices in turn, and returns
+// every line shown
+func talk(g *Game, tree *DialogueTree, picks ...int) []string {
+	d := g.dialogue
+	d.Open(g, tree)
+	var shown []string
+	for n := 0; d.IsOpen && n < 100; n++ {
+		if !d.Finished {
+			shown = append(shown, d.Node.line(d.CurrentLine).Text)
+		}
+		if d.choosing() {
+			d.Selected = picks[0]
+			picks = picks[1:]
+		}
+		d.Advance(g)
+	}
+	return shown
+}
+
+func TestDialogueTree(t *testing.T) {
+	tests := []struct {
+		name   string
+		flags  []string
+		picks  []int
+		shown  []string
+		agreed bool
+		maps   int
+	}{
+		{"yes", nil, []int{0}, []string{"Hi", "Coming along?", "Great"}, true, 1},
+		{"no", []string{"Agreed"}, []int{1}, []string{"Hi", "Coming along?", "Oh"}, false, 0},
+		{"friend says yes", []string{"Friends"}, []int{0}, []string{"Hi", "Coming along?", "Great", "See you, friend"}, true, 1},
+		{"friend back from town", []string{"Friends", "HasVisitedRedTown"}, []int{0}, []string{"Hi", "Coming along?", "Great", "Back to Red Town?"}, true, 1},
+		{"secret", []string{"Friends"}, []int{2}, []string{"Hi", "Coming along?", "Shh", "Great", "See you, friend"}, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newTestGame(t)
+			for _, f := range tt.flags {
+				g.Progress.SetFlag(f, true)
+			}
+			if shown := talk(g, testTree(), tt.picks...); !reflect.DeepEqual(shown, tt.shown) {
+				t.Errorf("shown %q, want %q", shown, tt.shown)
+			}
+			if g.dialogue.IsOpen {
+				t.Error("dialogue still open")
+			}
+			if got := g.Progress.Flag("Agreed"); got != tt.agreed {
+				t.Errorf("Agreed %v, want %v", got, tt.agreed)
+			}
+			if got := g.Progress.Items["map"]; got != tt.maps {
+				t.Errorf("%d maps, want %d", got, tt.maps)
+			}
+		})
+	}
+}
+
+// Choices whose conditions don't hold aren't offered
+func TestDialogueChoices(t *testing.T) {
+	for _, friends := range []bool{false, true} {
+		g := newTestGame(t)
+		g.Progress.SetFlag("Friends", friends)
+		g.dialogue.Open(g, testTree())
+		want := 2
+		if friends {
+			want = 3
+		}
+		if got := len(g.dialogue.Choices); got != want {
+			t.Errorf("Friends %v: %d choices, want %d", friends, got, want)
+		}
+	}
+}
+
+// Nodes without text apply their effects and move on, and one leading
+// nowhere closes the box before it opens
+func TestDialogueSilentNodes(t *testing.T) {
+	g := newTestGame(t)
+	tree := &DialogueTree{Start: "give", Nodes: map[string]*DialogueNode{
+		"give": {Effects: DialogueEffects{Give: []string{"coin"}}},
+	}}
+	if shown := talk(g, tree); len(shown) != 0 || g.dialogue.IsOpen {
+		t.Errorf("shown %q, open %v", shown, g.dialogue.IsOpen)
+	}
+	if g.Progress.Items["coin"] != 1 {
+		t.Error("no coin given")
+	}
+	if shown := talk(g, LinesTree("Bryan", []string{"a", "b"})); !reflect.DeepEqual(shown, []string{"a", "b"}) {
+		t.Errorf("lines tree shown %q", shown)
+	}
+}
+
+// Finishing a conversation takes the first choice each time and applies the
+// effects on the way
+func TestDialogueFinish(t *testing.T) {
+	g := newTestGame(t)
+	g.dialogue.Open(g, testTree())
+	g.dialogue.Finish(g)
+	if g.dialogue.IsOpen {
+		t.Error("dialogue still open")
+	}
+	if !g.Progress.Flag("Agreed") || g.Progress.Items["map"] != 1 {
+		t.Errorf("Agreed %v, %d maps", g.Progress.Flag("Agreed"), g.Progress.Items["map"])
+	}
+}
+
+// A conversation whose first choices go round in a circle still closes
+func TestDialogueFinishCircle(t *testing.T) {
+	g := newTestGame(t)
+	tree := &DialogueTree{Start: "a", Nodes: map[string]*DialogueNode{
+		"a": {Text: []DialogueLine{{Text: "A"}}, Choices: []DialogueChoice{{Text: "To b", Next: "b"}}},
+		"b": {Text: []DialogueLine{{Text: "B"}}, Choices: []DialogueChoice{{Text: "To a", Next: "a"}}, Effects: DialogueEffects{Give: []string{"coin"}}},
+	}}
+	g.dialogue.Open(g, tree)
+	g.dialogue.Finish(g)
+	if g.dialogue.IsOpen {
+		t.Error("dialogue still open")
+	}
+	if g.Progress.Items["coin"] == 0 {
+		t.Error("effects along the way didn't happen")
+	}
+}
+
+func TestDialogueDBPick(t *testing.T) {
+	conv := func(id string, scripted bool, when ...string) *Conversation {
+		return &Conversation{ID: id, When: when, Scripted: scripted, DialogueTree: *LinesTree("Bryan", []string{id})}
+	}
+	db := DialogueDB{"Bryan": {
+		conv("trip", true),
+		conv("red_town", false, "HasVisitedRedTown", "!AgreedToTrip"),
+		conv("friends", false, "HasMetNPCBryan"),
+		conv("greeting", false),
+	}}
+	tests := []struct {
+		flags []string
+		want  string
+	}{
+		{nil, "greeting"},
+		{[]string{"HasMetNPCBryan"}, "friends"},
+		{[]string{"HasMetNPCBryan", "HasVisitedRedTown"}, "red_town"},
+		{[]string{"HasMetNPCBryan", "HasVisitedRedTown", "AgreedToTrip"}, "friends"},
+	}
+	for _, tt := range tests {
+		g := newTestGame(t)
+		for _, f := range tt.flags {
+			g.Progress.SetFlag(f, true)
+		}
+		tree := db.Pick(g, "Bryan")
+		if tree == nil {
+			t.Errorf("%v: no conversation picked, want %s", tt.flags, tt.want)
+			continue
+		}
+		if got := tree.Nodes[tree.Start].Text[0].Text; got != tt.want {
+			t.Errorf("%v: picked %s, want %s", tt.flags, got, tt.want)
+		}
+	}
+	if tree := db.Pick(newTestGame(t), "Alice"); tree != nil {
+		t.Error("picked a conversation for an NPC without any")
+	}
+	if db.Get("Bryan", "trip") == nil || db.Get("Bryan", "weather") != nil {
+		t.Error("Get found the wrong conversations")
+	}
+}
+
+// Mistakes in a dialogue file say which conversation and node are wrong
+func TestLoadDialogueDBErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		err  string
+	}{
+		{"unknown start", `{"conversations": [{"id": "hi", "start": "a", "nodes": {}}]}`,
+			`conversation hi: start node "a" does not exist`},
+		{"unknown next", `{"conversations": [{"id": "hi", "start": "a", "nodes": {"a": {"text": ["A"], "next": "b"}}}]}`,
+			`conversation hi: node a: next node "b" does not exist`},
+		{"unknown choice", `{"conversations": [{"id": "hi", "start": "a", "nodes": {"a": {"text": ["A"], "choices": [{"text": "B", "next": "b"}]}}}]}`,
+			`conversation hi: node a: next node "b" does not exist`},
+		{"bad condition", `{"conversations": [{"id": "hi", "start": "a", "nodes": {"a": {"branches": [{"if": ["!"], "next": "a"}]}}}]}`,
+			`conversation hi: node a: bad flag name ""`},
+		{"bad when", `{"conversations": [{"id": "hi", "when": ["Has Met"], "start": "a", "nodes": {"a": {"text": ["A"]}}}]}`,
+			`conversation hi: bad flag name "Has Met"`},
+		{"duplicate id", `{"conversations": [{"id": "hi", "start": "a", "nodes": {"a": {}}}, {"id": "hi", "start": "a", "nodes": {"a": {}}}]}`,
+			`conversations need a unique id, got "hi"`},
+		{"choices without text", `{"conversations": [{"id": "hi", "start": "a", "nodes": {"a": {"choices": [{"text": "B"}]}}}]}`,
+			"conversation hi: node a: choices need some text to go with them"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assets := asset.New(fstest.MapFS{"dialogues/Bryan.json": {Data: []byte(tt.json)}})
+			_, err := loadDialogueDB(assets, "dialogues")
+			if want := "dialogues/Bryan.json: " + tt.err; err == nil || err.Error() != want {
+				t.Errorf("got %v, want %q", err, want)
+			}
+		})
+	}
+}
+
+func TestDialogueLines(t *testing.T) {
+	var n DialogueNode
+	err := json.Unmarshal([]byte(`{
+		"speaker": "Bryan",
+		"expression": "happy",
+		"text": [
+			"@bryan.first",
+			{"expression": "angry", "text": "@bryan.second"},
+			{"speaker": "player", "text": "@player.third"},
+			{"speaker": "player", "expression": "sad", "text": "@player.fourth"}
+		]
+	}`), &n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Lines without a speaker are the node's and take its expression if they
+	// don't have their own. Someone else's lines don't.
+	want := []DialogueLine{
+		{Speaker: "Bryan", Expression: "happy", Text: "@bryan.first"},
+		{Speaker: "Bryan", Expression: "angry", Text: "@bryan.second"},
+		{Speaker: "player", Text: "@player.third"},
+		{Speaker: "player", Expression: "sad", Text: "@player.fourth"},
+	}
+	for i := range n.Text {
+		if got := n.line(i); !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("line %d is %+v, want %+v", i, got, want[i])
+		}
+	}
+}
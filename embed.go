@@ -0,0 +1,15 @@
+//go:build embed
+
+package main
+
+import "embed"
+
+// Built with -tags embed, the game carries its files and runs from anywhere
+// as a single binary
+
+//go:embed assets cutscenes dialogues lang scenes
+var embeddedFiles embed.FS
+
+func init() {
+	gameFS = embeddedFiles
+}
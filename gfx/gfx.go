@@ -0,0 +1,40 @@
+// Package gfx draws the plain shapes the UI is made of, like dialogue boxes,
+// meters and fades, without making a new image for them every frame. Every
+// shape is one small white image, made once, stretched and tinted into place.
+package gfx
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+var (
+	whiteImage = ebiten.NewImage(3, 3)
+	// The middle pixel of whiteImage, so stretching it doesn't blend in the
+	// transparent edges of the texture
+	whitePixel = whiteImage.SubImage(image.Rect(1, 1, 2, 2)).(*ebiten.Image)
+)
+
+func init() {
+	whiteImage.Fill(color.White)
+}
+
+// FillRect fills the rectangle with its top left at x, y with clr
+func FillRect(dst *ebiten.Image, x, y, w, h float64, clr color.Color) {
+	if w <= 0 || h <= 0 {
+		return
+	}
+	var opts ebiten.DrawImageOptions
+	opts.GeoM.Scale(w, h)
+	opts.GeoM.Translate(x, y)
+	opts.ColorScale.ScaleWithColor(clr)
+	dst.DrawImage(whitePixel, &opts)
+}
+
+// Fill covers the whole of dst with clr, which may be see through
+func Fill(dst *ebiten.Image, clr color.Color) {
+	b := dst.Bounds()
+	FillRect(dst, float64(b.Min.X), float64(b.Min.Y), float64(b.Dx()), float64(b.Dy()), clr)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"ebi/locale"
+	"ebi/richtext"
+	"fmt"
+	"log"
+	"sort"
+)
+
+// Directory that loadLocale reads the string tables from, see package locale
+const langDir = "lang"
+
+// String IDs the code uses directly, besides the main menu's
+var codeStrings = []string{"language.name", "player.name"}
+
+// loadLocale reads the string tables and checks that their markup parses
+func (g *Game) loadLocale() error {
+	b, err := locale.Load(g.assets.FS(), langDir)
+	if err != nil {
+		return err
+	}
+	for _, c := range b.Catalogs {
+		for id, s := range c.Strings {
+			if _, err := richtext.Parse(s); err != nil {
+				return fmt.Errorf("%s: %s: %v", c.Path, id, err)
+			}
+		}
+	}
+	g.locale = b
+	return nil
+}
+
+// text returns what the player sees for a piece of game content, which may
+// be a string ID like "@menu.start"
+func (g *Game) text(s string) string {
+	return g.locale.Text(s)
+}
+
+// usedStrings returns every string ID the game refers to: in code, in the
+// scene files' NPC lines, in the dialogue files and in cutscene say steps
+func usedStrings(defs map[string]*SceneFile, db DialogueDB, env *ScriptEnv) map[string]bool {
+	used := make(map[string]bool)
+	add := func(texts ...string) {
+		for _, s := range texts {
+			if id, ok := locale.ID(s); ok {
+				used[id] = true
+			}
+		}
+	}
+	for _, id := range append(append([]string{}, codeStrings...), mainMenu...) {
+		used[id] = true
+	}
+	for _, def := range defs {
+		for _, n := range def.NPCs {
+			add(n.DisplayName)
+			add(n.Lines...)
+		}
+	}
+	for _, convs := range db {
+		for _, c := range convs {
+			for _, n := range c.Nodes {
+				for _, l := range n.Text {
+					add(l.Text)
+				}
+				for _, ch := range n.Choices {
+					add(ch.Text)
+				}
+			}
+		}
+	}
+	add(env.Texts...)
+	return used
+}
+
+// checkUsedStrings makes sure the fallback language has every string the
+// game refers to
+func (g *Game) checkUsedStrings(used map[string]bool) error {
+	ids := make([]string, 0, len(used))
+	for id := range used {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if !g.locale.Has(id) {
+			return fmt.Errorf("no %s string %q in %s", locale.Fallback, id, langDir)
+		}
+	}
+	return nil
+}
+
+// checkLang is what -checklang runs. It loads the content without starting
+// the game and lists the IDs each string table is missing and the strings
+// nothing uses. It returns the exit status.
+func checkLang() int {
+	assets := newAssets()
+	b, err := locale.Load(assets.FS(), langDir)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	defs, err := loadSceneFiles(assets, sceneDir)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	db, err := loadDialogueDB(assets, dialogueDir)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	env := newScriptEnv(defs, db)
+	if _, err := loadCutscenes(assets, cutsceneDir, env); err != nil {
+		log.Print(err)
+		return 1
+	}
+
+	problems := b.Check(usedStrings(defs, db, env))
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		return 1
+	}
+	fmt.Printf("%d string tables OK\n", len(b.Catalogs))
+	return 0
+}
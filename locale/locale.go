@@ -0,0 +1,174 @@
+// Package locale looks up player facing text in per-language string tables.
+// Each language has a flat JSON file named after its BCP 47 tag, such as
+// lang/en.json or lang/ja.json:
+//
+//	{"language.name": "English", "menu.start": "Start Game"}
+//
+// Game content refers to a string by writing its ID after an @, e.g.
+// "@bryan.greeting.1". Anything else is shown as written, and "@@" stands for
+// a literal @.
+package locale
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// Fallback is the language whose table is used for keys other tables miss.
+// Every ID the game uses must be in it.
+var Fallback = language.English
+
+// Catalog is one language's string table
+type Catalog struct {
+	Tag     language.Tag
+	Path    string
+	Strings map[string]string
+}
+
+// Bundle holds every language's table and which one is in use
+type Bundle struct {
+	Catalogs []*Catalog // Fallback first, then ordered by tag
+	current  *Catalog
+	matcher  language.Matcher
+	warned   map[string]bool // IDs already reported missing
+}
+
+// Load reads every *.json table in the directory dir of fsys. The fallback
+// language must be one of them.
+func Load(fsys fs.FS, dir string) (*Bundle, error) {
+	paths, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	b := &Bundle{warned: make(map[string]bool)}
+	var fallback *Catalog
+	for _, p := range paths {
+		name := strings.TrimSuffix(path.Base(p), path.Ext(p))
+		tag, err := language.Parse(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: file name is not a language tag: %v", p, err)
+		}
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return nil, err
+		}
+		c := &Catalog{Tag: tag, Path: p}
+		if err := json.Unmarshal(data, &c.Strings); err != nil {
+			return nil, fmt.Errorf("%s: %v", p, err)
+		}
+		if tag == Fallback {
+			fallback = c
+		} else {
+			b.Catalogs = append(b.Catalogs, c)
+		}
+	}
+	if fallback == nil {
+		return nil, fmt.Errorf("%s: no string table for %s", dir, Fallback)
+	}
+	b.Catalogs = append([]*Catalog{fallback}, b.Catalogs...)
+	tags := make([]language.Tag, len(b.Catalogs))
+	for i, c := range b.Catalogs {
+		tags[i] = c.Tag
+	}
+	b.matcher = language.NewMatcher(tags)
+	b.current = fallback
+	return b, nil
+}
+
+// Language returns the language in use
+func (b *Bundle) Language() language.Tag {
+	return b.current.Tag
+}
+
+// SetLanguage switches to the table closest to tag, e.g. en for en-GB
+func (b *Bundle) SetLanguage(tag language.Tag) {
+	_, i, _ := b.matcher.Match(tag)
+	b.current = b.Catalogs[i]
+}
+
+// NextLanguage switches to the next table, for cycling through them in a menu
+func (b *Bundle) NextLanguage() {
+	for i, c := range b.Catalogs {
+		if c == b.current {
+			b.current = b.Catalogs[(i+1)%len(b.Catalogs)]
+			return
+		}
+	}
+}
+
+// T returns the string with the given ID in the current language, or in the
+// fallback language if the current table doesn't have it. An ID neither has
+// is returned as it is so it shows up on screen.
+func (b *Bundle) T(id string) string {
+	if s, ok := b.current.Strings[id]; ok {
+		return s
+	}
+	if s, ok := b.Catalogs[0].Strings[id]; ok {
+		return s
+	}
+	if !b.warned[id] {
+		b.warned[id] = true
+		log.Printf("no string %q in any language", id)
+	}
+	return id
+}
+
+// Text resolves s if it refers to a string ID and returns it unchanged if not
+func (b *Bundle) Text(s string) string {
+	if id, ok := ID(s); ok {
+		return b.T(id)
+	}
+	return strings.TrimPrefix(s, "@")
+}
+
+// Has reports whether the fallback table has a string for id
+func (b *Bundle) Has(id string) bool {
+	_, ok := b.Catalogs[0].Strings[id]
+	return ok
+}
+
+// ID returns the string ID s refers to, if it refers to one
+func ID(s string) (string, bool) {
+	if strings.HasPrefix(s, "@") && !strings.HasPrefix(s, "@@") {
+		return s[1:], true
+	}
+	return "", false
+}
+
+// Check compares the tables against the IDs the game uses and describes
+// every ID a table is missing and every string no one uses
+func (b *Bundle) Check(used map[string]bool) []string {
+	var problems []string
+	ids := make([]string, 0, len(used))
+	for id := range used {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, c := range b.Catalogs {
+		for _, id := range ids {
+			if _, ok := c.Strings[id]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: missing %q", c.Path, id))
+			}
+		}
+		var unused []string
+		for id := range c.Strings {
+			if !used[id] {
+				unused = append(unused, id)
+			}
+		}
+		sort.Strings(unused)
+		for _, id := range unused {
+			problems = append(problems, fmt.Sprintf("%s: unused %q", c.Path, id))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,101 @@
+package locale
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"golang.org/x/text/language"
+)
+
+func testBundle(t *testing.T) *Bundle {
+	t.Helper()
+	b, err := Load(fstest.MapFS{
+		"lang/en.json": {Data: []byte(`{"language.name": "English", "greeting": "Hello", "farewell": "Bye"}`)},
+		"lang/ja.json": {Data: []byte(`{"language.name": "日本語", "greeting": "こんにちは"}`)},
+		"lang/fr.json": {Data: []byte(`{"language.name": "Français"}`)},
+	}, "lang")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestFallback(t *testing.T) {
+	b := testBundle(t)
+	if b.Language() != language.English {
+		t.Errorf("starts in %v, want English", b.Language())
+	}
+	b.SetLanguage(language.Japanese)
+	tests := []struct{ s, want string }{
+		{"@greeting", "こんにちは"},
+		{"@farewell", "Bye"},    // Missing from ja, so English
+		{"@nowhere", "nowhere"}, // Missing everywhere, shown as the ID
+		{"plain text", "plain text"},
+		{"@@greeting", "@greeting"},
+	}
+	for _, tt := range tests {
+		if got := b.Text(tt.s); got != tt.want {
+			t.Errorf("Text(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestSetLanguage(t *testing.T) {
+	b := testBundle(t)
+	for _, tt := range []struct{ tag, want language.Tag }{
+		{language.Japanese, language.Japanese},
+		{language.BritishEnglish, language.English},
+		{language.CanadianFrench, language.French},
+		{language.German, language.English}, // No table, so the fallback
+	} {
+		b.SetLanguage(tt.tag)
+		if got := b.Language(); got != tt.want {
+			t.Errorf("SetLanguage(%v) gave %v, want %v", tt.tag, got, tt.want)
+		}
+	}
+}
+
+// The menu cycles through every language, English first
+func TestNextLanguage(t *testing.T) {
+	b := testBundle(t)
+	var names []string
+	for i := 0; i < 4; i++ {
+		names = append(names, b.T("language.name"))
+		b.NextLanguage()
+	}
+	want := []string{"English", "Français", "日本語", "English"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("got %q, want %q", names, want)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	b := testBundle(t)
+	got := b.Check(map[string]bool{"language.name": true, "greeting": true})
+	want := []string{
+		`lang/en.json: unused "farewell"`,
+		`lang/fr.json: missing "greeting"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		fsys fstest.MapFS
+		err  string
+	}{
+		{fstest.MapFS{"lang/ja.json": {Data: []byte(`{}`)}}, "no string table for en"},
+		{fstest.MapFS{"lang/en.json": {Data: []byte(`{}`)}, "lang/english.json": {Data: []byte(`{}`)}}, "lang/english.json: file name is not a language tag"},
+		{fstest.MapFS{"lang/en.json": {Data: []byte(`{"a": 1}`)}}, "lang/en.json:"},
+	}
+	for _, tt := range tests {
+		_, err := Load(tt.fsys, "lang")
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("got error %v, want %q", err, tt.err)
+		}
+	}
+}
@@ -1,28 +1,46 @@
 package main
 
 import (
+	"ebi/anim"
+	"ebi/asset"
+	"ebi/camera"
+	"ebi/collision"
+	"ebi/gfx"
+	"ebi/locale"
 	"ebi/npc"
+	"ebi/palette"
 	"ebi/player"
+	"ebi/richtext"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"image"
 	"image/color"
+	"io/fs"
 	"log"
 	"math"
 	"os"
-	"strings"
+	"reflect"
 
 	"github.com/hajimehoshi/ebiten/v2"
-	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
 	"github.com/hajimehoshi/ebiten/v2/examples/resources/fonts"
 	"github.com/hajimehoshi/ebiten/v2/text"
 	"golang.org/x/image/font"
 	"golang.org/x/image/font/opentype"
-	"golang.org/x/image/math/fixed"
-	"golang.org/x/text/cases"
-	"golang.org/x/text/language"
 )
 
+// Size of the logical screen, see Layout
+const (
+	screenWidth  = 320
+	screenHeight = 240
+)
+
+// Default camera zoom, the maps are drawn at a quarter of their size
+const worldZoom = 0.25
+
+// How many cutscene updates run each frame while fast forwarding
+const cutsceneFastForward = 4
+
 type GameState int
 
 const (
@@ -35,44 +53,36 @@ const (
 	TimeStopped
 )
 
-type CutsceneActionType int
-
-const (
-	MovePlayer CutsceneActionType = iota
-	MoveNPC
-	ShowDialogue
-	TeleportNPC
-	TeleportPlayer
-	TurnNPC
-	TurnPlayer
-	FadeIn
-	FadeOut
-	ChangeScene
-)
-
-type CutsceneAction struct {
-	ActionType   CutsceneActionType
-	Target       interface{}
-	Data         interface{}
-	WaitPrevious bool // Whether to wait for previous actions to complete
-}
 type Vector2D struct {
 	X, Y float64
 }
 
-type Cutscene struct {
-	Game          *Game `json:"-"`
-	Actions       []CutsceneAction
-	Current       int
-	ActiveActions map[int]bool // Tracks active actions by their index
-	IsPlaying     bool
-	CleanUp       func(*Cutscene) `json:"-"`
-}
-
 type GameProgress struct {
 	HasVisitedRedTown     bool
 	HasMetNPCBryan        bool
 	FirstCutSceneFinished bool
+	Flags                 map[string]bool // Flags from dialogue and cutscenes that have no field of their own
+	Items                 map[string]int  // Items the player has been given, by name
+}
+
+// Flag returns a flag by name, either one of the bool fields above or one
+// from Flags
+func (p *GameProgress) Flag(name string) bool {
+	if f := reflect.ValueOf(p).Elem().FieldByName(name); f.IsValid() && f.Kind() == reflect.Bool {
+		return f.Bool()
+	}
+	return p.Flags[name]
+}
+
+func (p *GameProgress) SetFlag(name string, value bool) {
+	if f := reflect.ValueOf(p).Elem().FieldByName(name); f.IsValid() && f.Kind() == reflect.Bool {
+		f.SetBool(value)
+		return
+	}
+	if p.Flags == nil {
+		p.Flags = make(map[string]bool)
+	}
+	p.Flags[name] = value
 }
 
 type Door struct {
@@ -85,30 +95,54 @@ type Door struct {
 type Scene struct {
 	Name                   string
 	Game                   *Game `json:"-"`
-	obstacles              []*image.Rectangle
+	obstacles              *collision.World
 	doors                  []*Door
+	loaded                 bool // Whether the obstacles and doors have been added
 	Background, Foreground *ebiten.Image
+	props                  []*prop     // Cut out of the foreground
 	loadObsnDoors          func(*Game) `json:"-"`
 	loadNPCs               func(*Game) `json:"-"`
 	NPCs                   []*npc.NPC
+	def                    *SceneFile
 }
 
 type Dialogue struct {
-	TextLines         []string
-	CurrentLine       int
-	CharIndex         int
+	CurrentLine       int // Line of the current node being shown
+	CharIndex         int // Glyphs of the current line shown so far
 	FramesPerChar     int // Number of frames to wait before showing the next character
 	AccumulatedFrames int // Frame counter for the typewriter effect
 	IsOpen            bool
 	Finished          bool
+	Speaker           string        // Name on the plate above the box
+	Portrait          *ebiten.Image // Portrait of whoever says the current line, or nil
+	Tree              *DialogueTree
+	Node              *DialogueNode
+	Choices           []DialogueChoice // Choices of the current node whose conditions hold
+	Selected          int
+
+	keyUpPressedLastFrame   bool
+	keyDownPressedLastFrame bool
+
+	glyphs    []richtext.Glyph  // The current line with its markup parsed
+	placed    []richtext.Placed // glyphs wrapped and split into pages that fit the box
+	pageStart int               // Index of the first glyph on the page being shown
+	frame     int               // Counts up while open, for the text effects
 }
 
+// Where the dialogue text goes, see Dialogue.Draw
+const (
+	dialogueBoxHeight = 63
+	dialogueTextX     = 70 // From the left of the box, past the portrait
+	dialogueTextY     = 17 // Baseline of the first line, from the top of the box
+	dialogueTextWidth = 225
+)
+
 type Game struct {
 	player                  *player.Player
 	state                   GameState
-	alpha                   float64 // For the fade effect (0.0: fully transparent, 1.0: fully opaque)
-	fadeSpeed               float64 // How fast the fade occurs
-	menuOptions             []string
+	alpha                   float64  // For the fade effect (0.0: fully transparent, 1.0: fully opaque)
+	fadeSpeed               float64  // How fast the fade occurs
+	menuOptions             []string // String IDs, see mainMenu
 	Scenes                  map[string]*Scene
 	Progress                GameProgress
 	Cutscene                Cutscene
@@ -118,16 +152,35 @@ type Game struct {
 	keyPressCounter         map[ebiten.Key]int // Tracks duration of key presses
 	keyKPressedLastFrame    bool
 	keyZPressedLastFrame    bool
+	keyEscPressedLastFrame  bool
 	// keyRPressedLastFrame    bool
 	dialogue *Dialogue
 	fface    font.Face
 	Full     bool
+	camera   *camera.Camera
+
+	cutscenes       []*CutsceneScript
+	playedCutscenes map[string]bool
+	cutsceneQueue   []string // Cutscenes started from dialogue, played once it closes
+	dialogues       DialogueDB
+	locale          *locale.Bundle
+	speakers        map[string]speaker // Who can talk in dialogues, see portrait.go
+	assets          *asset.Manager
+	palettes        map[string]*palette.Palette
+	entities        byDepth        // Reused every frame, see drawEntities
+	watcher         *asset.Watcher // Set in dev mode, see devreload.go
+	devFrames       int
 }
 
+// Bumped whenever the meaning of saved fields changes
+const saveVersion = 1
+
 type SaveState struct {
+	Version         int
 	PlayerDirection string
+	PlayerSkin      string
 	PlayerPosition  Vector2D
-	NPCPositions    []Vector2D
+	NPCPositions    []Vector2D // NPCs of the current scene, in scene file order
 	CurrentScene    string
 	GameProgress
 }
@@ -160,6 +213,15 @@ func LoadGameState(filename string) (*SaveState, error) {
 	if err := decoder.Decode(&state); err != nil {
 		return nil, err
 	}
+	if state.Version < 1 {
+		// Old saves stored the background offset for the player and negated
+		// positions for NPCs instead of world positions
+		state.PlayerPosition = Vector2D{X: 592 - state.PlayerPosition.X, Y: 412 - state.PlayerPosition.Y}
+		for i, p := range state.NPCPositions {
+			state.NPCPositions[i] = Vector2D{X: -p.X, Y: -p.Y}
+		}
+		state.Version = saveVersion
+	}
 
 	return &state, nil
 }
@@ -168,6 +230,7 @@ func (g *Game) Update() error {
 	if g.keyPressCounter == nil {
 		g.keyPressCounter = make(map[ebiten.Key]int)
 	}
+	g.hotReload()
 	if g.state == OptionsState {
 		os.Exit(0)
 	} else if g.state == MenuState {
@@ -195,60 +258,73 @@ func (g *Game) Update() error {
 
 		// Select an option
 		if ebiten.IsKeyPressed(ebiten.KeyEnter) {
+			g.keyPressCounter[ebiten.KeyEnter]++
+		} else {
+			g.keyPressCounter[ebiten.KeyEnter] = 0
+		}
+		if g.keyPressCounter[ebiten.KeyEnter] == 1 {
 			switch g.selectedOption {
 			case 0: // Start the game
 				g.state = PlayState
-			case 1: // Options (if you have any)
+			case 1: // Switch to the next language, right away
+				g.locale.NextLanguage()
+				g.dialogue.Retranslate(g)
+			case 2: // Options (if you have any)
 				g.state = OptionsState
-			case 2: // Exit
+			case 3: // Exit
 				os.Exit(0)
 			}
 		}
 	} else if g.state == PlayState {
 		for _, cnpc := range g.Scenes[g.CurrentScene].NPCs {
-			if nearNPC(minX(g.player.X, g), minY(g.player.Y, g), cnpc.X, cnpc.Y) {
+			if nearNPC(g.player.X, g.player.Y, cnpc.X, cnpc.Y) {
 				if ebiten.IsKeyPressed(ebiten.KeyZ) && !g.keyZPressedLastFrame {
 					// Toggle NPC interaction state
 					if cnpc.InteractionState == npc.NoInteraction {
 						cnpc.InteractionState = npc.PlayerInteracted
 						g.Progress.HasMetNPCBryan = true
 						g.player.CanMove = false // Disallow player movement
-					} else if cnpc.InteractionState == npc.WaitingForPlayerToResume && g.dialogue.Finished && g.dialogue.IsLastLine() {
-						cnpc.InteractionState = npc.NoInteraction
-						g.player.CanMove = true // Allow player movement
 					}
 				}
 			}
 			cnpc.Update(ebiten.KeyZ)
-			if ebiten.IsKeyPressed(ebiten.KeyZ) && !g.keyZPressedLastFrame && nearNPC(minX(g.player.X, g), minY(g.player.Y, g), cnpc.X, cnpc.Y) {
+			if ebiten.IsKeyPressed(ebiten.KeyZ) && !g.keyZPressedLastFrame && nearNPC(g.player.X, g.player.Y, cnpc.X, cnpc.Y) {
 				if !g.dialogue.IsOpen {
-					g.dialogue.IsOpen = true
-					g.dialogue.CurrentLine = 0
-					g.dialogue.CharIndex = 0
-					g.dialogue.Finished = false
-					g.dialogue.TextLines = cnpc.DialogueText
-				} else {
-					if g.dialogue.Finished {
-						g.dialogue.NextLine()
-					} else {
-						// Instantly display all characters in the current line
-						g.dialogue.CharIndex = len(g.dialogue.TextLines[g.dialogue.CurrentLine])
-						g.dialogue.Finished = true
+					tree := g.dialogues.Pick(g, cnpc.Name)
+					if tree == nil {
+						tree = LinesTree(cnpc.Name, cnpc.DialogueText)
 					}
+					g.dialogue.Open(g, tree)
+				} else {
+					g.dialogue.Advance(g)
+				}
+				if !g.dialogue.IsOpen && cnpc.InteractionState == npc.WaitingForPlayerToResume {
+					// The conversation is over
+					cnpc.InteractionState = npc.NoInteraction
+					g.player.CanMove = true // Allow player movement
 				}
-
 			}
-
-			g.dialogue.Update()
-
 		}
+		// Once a frame, however many NPCs the scene has
+		g.dialogue.Update()
 		// fmt.Println("Player:", g.player.X, g.player.Y)
 		// fmt.Println("NPC:", g.Scenes[g.CurrentScene].NPCs[0].X, g.Scenes[g.CurrentScene].NPCs[0].Y)
 		g.keyZPressedLastFrame = ebiten.IsKeyPressed(ebiten.KeyZ)
-		if g.Progress.HasMetNPCBryan && g.Progress.HasVisitedRedTown && !g.dialogue.IsOpen && !g.Progress.FirstCutSceneFinished && g.Scenes[g.CurrentScene] == g.Scenes["mainMapRed"] {
-			g.Cutscene = createExampleCutscene(g)
-			g.Cutscene.Start()
-			g.state = CutsceneState
+		if !g.dialogue.IsOpen && len(g.cutsceneQueue) > 0 {
+			name := g.cutsceneQueue[0]
+			g.cutsceneQueue = g.cutsceneQueue[1:]
+			if err := g.StartCutscene(name); err != nil {
+				log.Fatal(err)
+			}
+		} else if !g.dialogue.IsOpen {
+			for _, script := range g.cutscenes {
+				if script.Triggered(g) {
+					if err := g.StartCutscene(script.Name); err != nil {
+						log.Fatal(err)
+					}
+					break
+				}
+			}
 		}
 		if ebiten.IsKeyPressed(ebiten.KeyG) && g.player.GhostModeCooldown <= 0 {
 			g.player.GhostMode = true
@@ -269,114 +345,8 @@ func (g *Game) Update() error {
 			}
 			fmt.Println(g.player.GhostModeCooldown)
 		}
-		colliding := false
-		movementKeyPressed := false
-		var moveX, moveY float64
-		g.player.TickCounter++
-		if g.player.CanMove {
-			// Handle player movement
-			if ebiten.IsKeyPressed(ebiten.KeyLeft) {
-				g.player.DoubleTapKey = ebiten.KeyLeft
-				if !g.player.KeyBeingPressed {
-					fmt.Println(g.player.TickCounter)
-					// Key is pressed for the first time or after being released
-					g.player.KeyBeingPressed = true
-					if g.player.TickCounter-g.player.LastKeyPressTick <= 15 && g.player.TickCounter-g.player.LastKeyPressTick > 0 {
-						g.player.IsRunning = true
-					}
-					g.player.LastKeyPressTick = g.player.TickCounter
-				}
-				X, Y := g.player.CheckMove("left")
-				g.player.Direction = "left"
-				moveX = X
-				moveY = Y
-				movementKeyPressed = true
-			}
-			if ebiten.IsKeyPressed(ebiten.KeyRight) {
-				g.player.DoubleTapKey = ebiten.KeyRight
-				if !g.player.KeyBeingPressed {
-					fmt.Println(g.player.TickCounter)
-					// Key is pressed for the first time or after being released
-					g.player.KeyBeingPressed = true
-					if g.player.TickCounter-g.player.LastKeyPressTick <= 15 && g.player.TickCounter-g.player.LastKeyPressTick > 0 {
-						g.player.IsRunning = true
-					}
-					g.player.LastKeyPressTick = g.player.TickCounter
-				}
-				X, Y := g.player.CheckMove("right")
-				g.player.Direction = "right"
-				moveX = X
-				moveY = Y
-				movementKeyPressed = true
-
-			}
-			if ebiten.IsKeyPressed(ebiten.KeyUp) {
-				g.player.DoubleTapKey = ebiten.KeyUp
-				if !g.player.KeyBeingPressed {
-					fmt.Println(g.player.TickCounter)
-					// Key is pressed for the first time or after being released
-					g.player.KeyBeingPressed = true
-					if g.player.TickCounter-g.player.LastKeyPressTick <= 15 && g.player.TickCounter-g.player.LastKeyPressTick > 0 {
-						g.player.IsRunning = true
-					}
-					g.player.LastKeyPressTick = g.player.TickCounter
-				}
-				X, Y := g.player.CheckMove("up")
-				g.player.Direction = "up"
-				moveX = X
-				moveY = Y
-				movementKeyPressed = true
-			}
-			if ebiten.IsKeyPressed(ebiten.KeyDown) {
-				g.player.DoubleTapKey = ebiten.KeyDown
-				if !g.player.KeyBeingPressed {
-					fmt.Println(g.player.TickCounter)
-					// Key is pressed for the first time or after being released
-					g.player.KeyBeingPressed = true
-					if g.player.TickCounter-g.player.LastKeyPressTick <= 15 && g.player.TickCounter-g.player.LastKeyPressTick > 0 {
-						g.player.IsRunning = true
-					}
-					g.player.LastKeyPressTick = g.player.TickCounter
-				}
-				X, Y := g.player.CheckMove("down")
-				g.player.Direction = "down"
-				moveX = X
-				moveY = Y
-				movementKeyPressed = true
-			}
-		}
-		g.player.KeyBeingPressed = ebiten.IsKeyPressed(g.player.DoubleTapKey)
-		if g.player.IsRunning && !g.player.KeyBeingPressed {
-			g.player.IsRunning = false
-		}
-		// if moveX != 0 {
-		// 	fmt.Println(minX(moveX, g), minY(moveY, g))
-		// 	fmt.Println(*g.obstacles[0])
-		// }
-
-		for _, obstacle := range g.Scenes[g.CurrentScene].obstacles {
-			obsMinX := float64(obstacle.Min.X)
-			obsMaxX := float64(obstacle.Max.X)
-			obsMinY := float64(obstacle.Min.Y)
-			obsMaxY := float64(obstacle.Max.Y)
-			if !g.player.GhostMode && obsMinX < minX(moveX, g) && obsMaxX > maxX(moveX, g) && obsMinY < minY(moveY, g) && obsMaxY > maxY(moveY, g) {
-				moveX = g.player.X
-				moveY = g.player.Y
-				colliding = true
-			}
-		}
-		for _, door := range g.Scenes[g.CurrentScene].doors {
-			obsMinX := float64(door.Rect.Min.X)
-			obsMaxX := float64(door.Rect.Max.X)
-			obsMinY := float64(door.Rect.Min.Y)
-			obsMaxY := float64(door.Rect.Max.Y)
-			if obsMinX < minX(moveX, g) && obsMaxX > maxX(moveX, g) && obsMinY < minY(moveY, g) && obsMaxY > maxY(moveY, g) {
-				if colliding {
-					g.state = TransitionState
-					g.CurrentDoor = door
-					g.Progress.HasVisitedRedTown = true
-				}
-			}
+		if g.movePlayer() {
+			g.enterDoor()
 		}
 		// Check for proximity and key press to interact with the NPC
 
@@ -406,11 +376,13 @@ func (g *Game) Update() error {
 			g.Full = !g.Full
 			ebiten.SetFullscreen(g.Full)
 			s := &SaveState{
+				Version:         saveVersion,
 				PlayerPosition:  Vector2D{g.player.X, g.player.Y},
 				PlayerDirection: g.player.Direction,
+				PlayerSkin:      g.player.Skin,
 				CurrentScene:    g.CurrentScene,
 				GameProgress:    g.Progress,
-				NPCPositions:    []Vector2D{{X: g.Scenes[g.CurrentScene].NPCs[0].X, Y: g.Scenes[g.CurrentScene].NPCs[0].Y}},
+				NPCPositions:    npcPositions(g.Scenes[g.CurrentScene].NPCs),
 			}
 			err := SaveGameState(s, "savefile.json")
 			if err != nil {
@@ -428,48 +400,20 @@ func (g *Game) Update() error {
 
 		}
 		g.keyKPressedLastFrame = ebiten.IsKeyPressed(ebiten.KeyK)
-		if g.player.CanMove {
-			// Handle player movement
-			if ebiten.IsKeyPressed(ebiten.KeyLeft) {
-				g.player.X = moveX
-				movementKeyPressed = true
-			}
-			if ebiten.IsKeyPressed(ebiten.KeyRight) {
-
-				g.player.X = moveX
-				movementKeyPressed = true
-			}
-			if ebiten.IsKeyPressed(ebiten.KeyUp) {
-				g.player.Y = moveY
-				movementKeyPressed = true
-			}
-			if ebiten.IsKeyPressed(ebiten.KeyDown) {
-				g.player.Y = moveY
-				movementKeyPressed = true
-			}
-			if movementKeyPressed {
-				// Increment the tick count
-				g.player.TickCount++
-			}
-
+		if ebiten.IsKeyPressed(ebiten.KeyEscape) && !g.keyEscPressedLastFrame {
+			// Back to the menu, where Start carries on
+			g.state = MenuState
 		}
+		g.keyEscPressedLastFrame = ebiten.IsKeyPressed(ebiten.KeyEscape)
 
-		// Update the current frame every 10 ticks
-		if g.player.TickCount >= 10 {
-			g.player.CurrentFrame = (g.player.CurrentFrame + 1) % g.player.FrameCount
-			g.player.TickCount = 0 // Reset the tick count
-		}
+		g.player.Animate()
 	} else if g.state == TransitionState {
 		// Increase the alpha for the fade out effect
 		g.alpha += g.fadeSpeed
 		if g.alpha >= 1.0 {
 			g.alpha = 1.0
 			g.state = NewSceneState
-			g.changeScene(g.CurrentScene, g.CurrentDoor.Destination)
-			g.player.X = g.CurrentDoor.NewX
-			g.player.Y = g.CurrentDoor.NewY
-			g.Scenes[g.CurrentScene].loadObsnDoors(g)
-			g.Scenes[g.CurrentScene].loadNPCs(g)
+			g.enterScene(g.CurrentDoor.Destination, g.CurrentDoor.NewX, g.CurrentDoor.NewY)
 		}
 	} else if g.state == NewSceneState {
 		// Decrease the alpha for the fade in effect
@@ -480,8 +424,26 @@ func (g *Game) Update() error {
 			// The new scene is fully visible now, and game continues as normal
 		}
 	} else if g.state == CutsceneState {
-		g.Cutscene.Update()
-
+		if ebiten.IsKeyPressed(ebiten.KeyEscape) && !g.keyEscPressedLastFrame {
+			// Skip to the end
+			g.Cutscene.Skip()
+		} else {
+			// Holding X fast forwards
+			steps := 1
+			if ebiten.IsKeyPressed(ebiten.KeyX) {
+				steps = cutsceneFastForward
+			}
+			for i := 0; i < steps && g.state == CutsceneState; i++ {
+				if i > 0 {
+					g.followPlayer()
+					g.camera.Update()
+				}
+				g.Cutscene.Update()
+				// One press of Z should only move the dialogue on once
+				g.keyZPressedLastFrame = ebiten.IsKeyPressed(ebiten.KeyZ)
+			}
+		}
+		g.keyEscPressedLastFrame = ebiten.IsKeyPressed(ebiten.KeyEscape)
 		g.keyZPressedLastFrame = ebiten.IsKeyPressed(ebiten.KeyZ)
 	} else if g.state == TimeStopped {
 		if ebiten.IsKeyPressed(ebiten.KeyG) && g.player.GhostModeCooldown <= 0 {
@@ -503,437 +465,145 @@ func (g *Game) Update() error {
 			}
 			fmt.Println(g.player.GhostModeCooldown)
 		}
-		colliding := false
-		movementKeyPressed := false
-		var moveX, moveY float64
-		g.player.TickCounter++
-		if g.player.CanMove {
-			// Handle player movement
-			if ebiten.IsKeyPressed(ebiten.KeyLeft) {
-				g.player.DoubleTapKey = ebiten.KeyLeft
-				if !g.player.KeyBeingPressed {
-					fmt.Println(g.player.TickCounter)
-					// Key is pressed for the first time or after being released
-					g.player.KeyBeingPressed = true
-					if g.player.TickCounter-g.player.LastKeyPressTick <= 15 && g.player.TickCounter-g.player.LastKeyPressTick > 0 {
-						g.player.IsRunning = true
-					}
-					g.player.LastKeyPressTick = g.player.TickCounter
-				}
-				X, Y := g.player.CheckMove("left")
-				g.player.Direction = "left"
-				moveX = X
-				moveY = Y
-				movementKeyPressed = true
-			}
-			if ebiten.IsKeyPressed(ebiten.KeyRight) {
-				g.player.DoubleTapKey = ebiten.KeyRight
-				if !g.player.KeyBeingPressed {
-					fmt.Println(g.player.TickCounter)
-					// Key is pressed for the first time or after being released
-					g.player.KeyBeingPressed = true
-					if g.player.TickCounter-g.player.LastKeyPressTick <= 15 && g.player.TickCounter-g.player.LastKeyPressTick > 0 {
-						g.player.IsRunning = true
-					}
-					g.player.LastKeyPressTick = g.player.TickCounter
-				}
-				X, Y := g.player.CheckMove("right")
-				g.player.Direction = "right"
-				moveX = X
-				moveY = Y
-				movementKeyPressed = true
-
-			}
-			if ebiten.IsKeyPressed(ebiten.KeyUp) {
-				g.player.DoubleTapKey = ebiten.KeyUp
-				if !g.player.KeyBeingPressed {
-					fmt.Println(g.player.TickCounter)
-					// Key is pressed for the first time or after being released
-					g.player.KeyBeingPressed = true
-					if g.player.TickCounter-g.player.LastKeyPressTick <= 15 && g.player.TickCounter-g.player.LastKeyPressTick > 0 {
-						g.player.IsRunning = true
-					}
-					g.player.LastKeyPressTick = g.player.TickCounter
-				}
-				X, Y := g.player.CheckMove("up")
-				g.player.Direction = "up"
-				moveX = X
-				moveY = Y
-				movementKeyPressed = true
-			}
-			if ebiten.IsKeyPressed(ebiten.KeyDown) {
-				g.player.DoubleTapKey = ebiten.KeyDown
-				if !g.player.KeyBeingPressed {
-					fmt.Println(g.player.TickCounter)
-					// Key is pressed for the first time or after being released
-					g.player.KeyBeingPressed = true
-					if g.player.TickCounter-g.player.LastKeyPressTick <= 15 && g.player.TickCounter-g.player.LastKeyPressTick > 0 {
-						g.player.IsRunning = true
-					}
-					g.player.LastKeyPressTick = g.player.TickCounter
-				}
-				X, Y := g.player.CheckMove("down")
-				g.player.Direction = "down"
-				moveX = X
-				moveY = Y
-				movementKeyPressed = true
-			}
-		}
-		g.player.KeyBeingPressed = ebiten.IsKeyPressed(g.player.DoubleTapKey)
-		if g.player.IsRunning && !g.player.KeyBeingPressed {
-			g.player.IsRunning = false
+		if g.movePlayer() {
+			g.enterDoor()
 		}
-		// if moveX != 0 {
-		// 	fmt.Println(minX(moveX, g), minY(moveY, g))
-		// 	fmt.Println(*g.obstacles[0])
-		// }
 
-		for _, obstacle := range g.Scenes[g.CurrentScene].obstacles {
-			obsMinX := float64(obstacle.Min.X)
-			obsMaxX := float64(obstacle.Max.X)
-			obsMinY := float64(obstacle.Min.Y)
-			obsMaxY := float64(obstacle.Max.Y)
-			if !g.player.GhostMode && obsMinX < minX(moveX, g) && obsMaxX > maxX(moveX, g) && obsMinY < minY(moveY, g) && obsMaxY > maxY(moveY, g) {
-				moveX = g.player.X
-				moveY = g.player.Y
-				colliding = true
-			}
-		}
-		for _, door := range g.Scenes[g.CurrentScene].doors {
-			obsMinX := float64(door.Rect.Min.X)
-			obsMaxX := float64(door.Rect.Max.X)
-			obsMinY := float64(door.Rect.Min.Y)
-			obsMaxY := float64(door.Rect.Max.Y)
-			if obsMinX < minX(moveX, g) && obsMaxX > maxX(moveX, g) && obsMinY < minY(moveY, g) && obsMaxY > maxY(moveY, g) {
-				if colliding {
-					g.state = TransitionState
-					g.CurrentDoor = door
-					g.Progress.HasVisitedRedTown = true
-				}
-			}
-		}
-		if g.player.CanMove {
-			// Handle player movement
-			if ebiten.IsKeyPressed(ebiten.KeyLeft) {
-				g.player.X = moveX
-				movementKeyPressed = true
-			}
-			if ebiten.IsKeyPressed(ebiten.KeyRight) {
-
-				g.player.X = moveX
-				movementKeyPressed = true
-			}
-			if ebiten.IsKeyPressed(ebiten.KeyUp) {
-				g.player.Y = moveY
-				movementKeyPressed = true
-			}
-			if ebiten.IsKeyPressed(ebiten.KeyDown) {
-				g.player.Y = moveY
-				movementKeyPressed = true
-			}
-			if movementKeyPressed {
-				// Increment the tick count
-				g.player.TickCount++
-			}
-
-		}
-
-		// Update the current frame every 10 ticks
-		if g.player.TickCount >= 10 {
-			g.player.CurrentFrame = (g.player.CurrentFrame + 1) % g.player.FrameCount
-			g.player.TickCount = 0 // Reset the tick count
-		}
+		g.player.Animate()
 		if !ebiten.IsKeyPressed(ebiten.KeyS) {
 			g.state = PlayState
 		}
 	}
+	if g.state != MenuState {
+		g.followPlayer()
+		g.camera.Update()
+	}
 	return nil
 }
-func CleanUpCutScene1(c *Cutscene) {
-	c.IsPlaying = false
-	c.Game.Scenes[c.Game.CurrentScene].NPCs[0].X = -900
-	c.Game.Scenes[c.Game.CurrentScene].NPCs[0].Y = -950
-	c.Game.Scenes[c.Game.CurrentScene].NPCs[0].Direction = "left"
-	c.Game.state = PlayState
-	c.Game.Progress.FirstCutSceneFinished = true
-	fmt.Println("finished")
-}
-func (c *Cutscene) Start() {
-	c.Current = 0
-	c.IsPlaying = true
-	c.ActiveActions = make(map[int]bool)
-}
-
-func (c *Cutscene) Update() {
-	if !c.IsPlaying {
-		return
-	}
-
-	for i, action := range c.Actions {
-		if i < c.Current && !c.ActiveActions[i] {
-			// Skip completed actions
-			continue
-		}
 
-		if action.WaitPrevious && i > c.Current {
-			// If the action should wait for previous ones, don't start it yet
+// StartCutscene plays the cutscene script with the given name
+func (g *Game) StartCutscene(name string) error {
+	for _, script := range g.cutscenes {
+		if script.Name != name {
 			continue
 		}
-
-		// Process the action
-		completed := c.processAction(action)
-		if completed {
-			c.ActiveActions[i] = false // Mark action as completed
-			if i == c.Current {
-				c.Current++ // Move to the next action
-			}
-		} else {
-			c.ActiveActions[i] = true // Mark action as active
-		}
-	}
-
-	// Check if all actions are completed
-	if c.Current >= len(c.Actions) {
-		c.CleanUp(c)
-		c.Game.state = PlayState
-	}
-}
-
-func (c *Cutscene) processAction(action CutsceneAction) bool {
-	switch action.ActionType {
-	case MoveNPC:
-		cnpc := action.Target.(*npc.NPC)
-		destination := action.Data.(Vector2D)
-		return moveTowards(cnpc, destination)
-	case MovePlayer:
-		p := action.Target.(*player.Player)
-		destination := action.Data.(Vector2D)
-		return moveTowards(p, destination)
-	case FadeOut:
-		g := c.Game
-		g.alpha += action.Data.(float64)
-		f := false
-		if g.alpha >= 1.0 {
-			g.alpha = 1.0
-			f = true
-		}
-		return f
-	case FadeIn:
-		g := c.Game
-		g.alpha -= action.Data.(float64)
-		f := false
-		if g.alpha <= 0.0 {
-			g.alpha = 0.0
-			f = true
-			// The new scene is fully visible now, and game continues as normal
-		}
-		return f
-	case TeleportPlayer:
-		p := action.Target.(*player.Player)
-		destination := action.Data.(Vector2D)
-		p.X = destination.X
-		p.Y = destination.Y
-		return true
-	case TeleportNPC:
-		cnpc := action.Target.(*npc.NPC)
-		destination := action.Data.(Vector2D)
-		cnpc.X = destination.X
-		cnpc.Y = destination.Y
-		return true
-	case TurnPlayer:
-		p := action.Target.(*player.Player)
-		dir := action.Data.(string)
-		p.Direction = dir
-		return true
-	case TurnNPC:
-		p := action.Target.(*npc.NPC)
-		dir := action.Data.(string)
-		p.Direction = dir
-		return true
-	case ShowDialogue:
-		d := action.Target.(*Dialogue)
-		if !d.IsOpen {
-			d.IsOpen = true
-			d.CurrentLine = 0
-			d.CharIndex = 0
-			d.Finished = false
-			d.TextLines = action.Data.([]string)
-		} else {
-			g := c.Game
-			if ebiten.IsKeyPressed(ebiten.KeyZ) && !g.keyZPressedLastFrame {
-				if d.Finished {
-					d.NextLine()
-					if !d.IsOpen {
-						return true
-					}
-				} else {
-					// Instantly display all characters in the current line
-					d.CharIndex = len(d.TextLines[d.CurrentLine])
-					d.Finished = true
-				}
-				g.keyZPressedLastFrame = ebiten.IsKeyPressed(ebiten.KeyZ)
-
-			}
-			d.Update()
-			// return d.Finished
+		c, err := script.Build(g)
+		if err != nil {
+			return err
 		}
+		g.Cutscene = c
+		g.Cutscene.Start()
+		g.playedCutscenes[name] = true
+		g.state = CutsceneState
+		return nil
 	}
-	return false
+	return fmt.Errorf("unknown cutscene %q", name)
 }
 
-func moveTowards(entity interface{}, target Vector2D) bool {
-	const speed = 5.0
-	res := false
-	switch e := entity.(type) {
-	case *player.Player:
-		if e.X < target.X {
-			e.Direction = "left"
-			e.X += speed
-		} else if e.X > target.X {
-			e.Direction = "right"
-			e.X -= speed
-		} else if e.Y > target.Y {
-			e.Direction = "down"
-			e.Y -= speed
-		} else if e.Y < target.Y {
-			e.Direction = "up"
-			e.Y += speed
-		} else {
-			e.CurrentFrame = 2
-			res = true
-		}
-		e.TickCount++
-		if e.TickCount >= 10 && !res {
-			e.CurrentFrame = (e.CurrentFrame + 1) % e.FrameCount
-			e.TickCount = 0 // Reset the tick count
-		}
-	case *npc.NPC:
-		if e.X < target.X {
-			e.Direction = "left"
-			e.X += speed
-		} else if e.X > target.X {
-			e.Direction = "right"
-			e.X -= speed
-		} else if e.Y > target.Y {
-			e.Direction = "down"
-			e.Y -= speed
-		} else if e.Y < target.Y {
-			e.Direction = "up"
-			e.Y += speed
-		} else {
-			// e.CurrentFrame = 2
-			res = true
-		}
-		e.TickCount++
-		if e.TickCount >= 10 && !res {
-			e.CurrentFrame = (e.CurrentFrame + 1) % e.FrameCount
-			e.TickCount = 0 // Reset the tick count
-		}
-	default:
-		res = true
-	}
-	return res
-}
+//	func (c *Cutscene) Draw(screen *ebiten.Image) {
+//		// ... draw anything related to the cutscene ...
+//	}
 
-func createExampleCutscene(g *Game) Cutscene {
-	return Cutscene{
-		CleanUp: CleanUpCutScene1,
-		Game:    g,
-		Actions: []CutsceneAction{
-			{
-				ActionType:   FadeOut,
-				Data:         0.01,
-				WaitPrevious: false,
-			},
-			{
-				ActionType:   TeleportPlayer,
-				Target:       g.player,
-				Data:         Vector2D{X: 100, Y: 100},
-				WaitPrevious: true,
-			},
-			{
-				ActionType:   TeleportNPC,
-				Target:       g.Scenes[g.CurrentScene].NPCs[0],
-				Data:         Vector2D{X: 150 - 600, Y: 150 - 400},
-				WaitPrevious: true,
-			},
-			{
-				ActionType:   FadeIn,
-				Data:         0.01,
-				WaitPrevious: true,
-			},
-			{
-				ActionType:   MovePlayer,
-				Target:       g.player,
-				Data:         Vector2D{X: -100, Y: -140}, // Target position for player
-				WaitPrevious: true,
-			},
-			{
-				ActionType:   MoveNPC,
-				Target:       g.Scenes[g.CurrentScene].NPCs[0],
-				Data:         Vector2D{X: -150 - 600, Y: -150 - 400}, // Target position for NPC
-				WaitPrevious: false,
-			},
-			{
-				ActionType:   TurnNPC,
-				Target:       g.Scenes[g.CurrentScene].NPCs[0],
-				Data:         "left",
-				WaitPrevious: true,
-			},
-			{
-				ActionType:   TurnPlayer,
-				Target:       g.player,
-				Data:         "right",
-				WaitPrevious: true,
-			},
-			{
-				ActionType:   ShowDialogue,
-				Target:       g.dialogue,
-				Data:         []string{"This is our first Scene.", "Pretty Cool huh?"},
-				WaitPrevious: true,
-			},
-		},
-	}
+// followPlayer points the camera at the middle of the player
+func (g *Game) followPlayer() {
+	w, h := g.player.Size()
+	g.camera.Follow(g.player.X+float64(w)/2, g.player.Y+float64(h)/2)
 }
-func (g *Game) StartCutscene() {
-
-	g.Cutscene = createExampleCutscene(g)
-	g.Cutscene.Start()
 
+// resetCamera fits the camera to the current scene and jumps to the player
+func (g *Game) resetCamera() {
+	g.camera.Bounds = g.Scenes[g.CurrentScene].Background.Bounds()
+	g.followPlayer()
+	g.camera.Snap(g.camera.Target())
 }
 
-//	func (c *Cutscene) Draw(screen *ebiten.Image) {
-//		// ... draw anything related to the cutscene ...
-//	}
-func (d *Dialogue) IsLastLine() bool {
-	return d.CurrentLine == len(d.TextLines)-1
-}
 func nearNPC(playerX, playerY, npcX, npcY float64) bool {
-	npcX *= -1
-	npcY *= -1
-	npcX += 192 / 4
-	npcY += 68
 	// Define what "near" means, e.g., within 50 pixels
 	const proximityThreshold = 50.0
 	return math.Abs(playerX-npcX) < proximityThreshold && math.Abs(playerY-npcY) < proximityThreshold
 }
-func minX(moveX float64, g *Game) float64 {
-	screenWidth, _ := ebiten.WindowSize()
-	return ((moveX - float64(screenWidth)) * -1)
+
+// movePlayer walks the player in the direction of the held arrow keys, up to
+// 8 ways. It returns whether the player walked into an obstacle.
+func (g *Game) movePlayer() bool {
+	p := g.player
+	p.TickCounter++
+	var dx, dy float64
+	facing := ""
+	if p.CanMove {
+		for _, k := range movementKeys {
+			if !ebiten.IsKeyPressed(k.key) {
+				continue
+			}
+			p.PressKey(k.key)
+			dx += k.dx
+			dy += k.dy
+			// Keep facing the same way while it is still held, so adding a
+			// second arrow key doesn't snap the sprite around
+			if facing == "" || k.dir == p.Direction {
+				facing = k.dir
+			}
+		}
+	}
+	p.KeyBeingPressed = ebiten.IsKeyPressed(p.DoubleTapKey)
+	if p.IsRunning && !p.KeyBeingPressed {
+		p.IsRunning = false
+	}
+	p.Moving = facing != ""
+	if !p.Moving {
+		return false
+	}
+
+	p.Direction = facing
+	moveX, moveY := p.CheckMove(dx, dy)
+	x, y, hit := g.slidePlayer(moveX, moveY)
+	p.X, p.Y = x, y
+	return hit
 }
-func maxX(moveX float64, g *Game) float64 {
-	screenWidth, _ := ebiten.WindowSize()
-	return ((moveX - float64(screenWidth) + float64(g.player.FrameWidth)) * -1)
+
+var movementKeys = []struct {
+	key    ebiten.Key
+	dir    string
+	dx, dy float64
+}{
+	{ebiten.KeyLeft, "left", -1, 0},
+	{ebiten.KeyRight, "right", 1, 0},
+	{ebiten.KeyUp, "up", 0, -1},
+	{ebiten.KeyDown, "down", 0, 1},
 }
-func minY(moveY float64, g *Game) float64 {
-	_, screenHeight := ebiten.WindowSize()
-	return ((moveY - float64(screenHeight)) * -1)
+
+// slidePlayer moves the player towards moveX, moveY through the scene's
+// obstacles. The X and Y moves are resolved one after the other, so when one
+// axis is blocked the player still slides along the wall on the other.
+func (g *Game) slidePlayer(moveX, moveY float64) (float64, float64, bool) {
+	if g.player.GhostMode {
+		return moveX, moveY, false
+	}
+	world := g.Scenes[g.CurrentScene].obstacles
+	box := g.playerBox(g.player.X, g.player.Y)
+	movedX, hitX := world.Move(box, collision.Vec{X: moveX - g.player.X})
+	movedY, hitY := world.Move(box.Translate(movedX), collision.Vec{Y: moveY - g.player.Y})
+	moved := movedX.Add(movedY)
+	return g.player.X + moved.X, g.player.Y + moved.Y, hitX || hitY
 }
-func maxY(moveY float64, g *Game) float64 {
-	_, screenHeight := ebiten.WindowSize()
-	return ((moveY - float64(screenHeight) + float64(g.player.FrameHeight)) * -1)
+
+// playerBox returns the world area the player covers at x, y
+func (g *Game) playerBox(x, y float64) collision.Rect {
+	w, h := g.player.Size()
+	return collision.NewRect(x, y, x+float64(w), y+float64(h))
 }
 
+// enterDoor starts the scene transition when the player is in a doorway
+func (g *Game) enterDoor() {
+	box := g.playerBox(g.player.X, g.player.Y)
+	for _, door := range g.Scenes[g.CurrentScene].doors {
+		r := door.Rect
+		if box.Intersects(collision.NewRect(float64(r.Min.X), float64(r.Min.Y), float64(r.Max.X), float64(r.Max.Y))) {
+			g.state = TransitionState
+			g.CurrentDoor = door
+		}
+	}
+}
 func loadFontFace() (font.Face, error) {
 	// Read the font data
 	fontBytes := fonts.MPlus1pRegular_ttf
@@ -941,7 +611,7 @@ func loadFontFace() (font.Face, error) {
 	// Parse the font data
 	fontParsed, err := opentype.Parse(fontBytes)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	// Specify the font size
@@ -952,38 +622,191 @@ func loadFontFace() (font.Face, error) {
 		Hinting: font.HintingFull,
 	})
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	return face, nil
 }
 
+// Open starts a conversation at the tree's start node
+func (d *Dialogue) Open(g *Game, tree *DialogueTree) {
+	d.Tree = tree
+	d.IsOpen = true
+	d.enter(g, tree.Start)
+}
+
+// enter moves the conversation to a node and applies its effects. Nodes
+// without text move straight on, and an empty id closes the dialogue.
+func (d *Dialogue) enter(g *Game, id string) {
+	// Stop eventually if nodes without text lead round in a circle
+	for n := 0; n <= len(d.Tree.Nodes); n++ {
+		if id == "" {
+			break
+		}
+		node := d.Tree.Nodes[id]
+		node.Effects.apply(g)
+		if len(node.Text) == 0 {
+			id = d.next(g, node)
+			continue
+		}
+		d.Node = node
+		d.showLine(g, 0)
+		d.Choices = d.Choices[:0]
+		for _, c := range node.Choices {
+			if holds(g, c.If) {
+				d.Choices = append(d.Choices, c)
+			}
+		}
+		d.Selected = 0
+		return
+	}
+	d.IsOpen = false
+	d.Tree, d.Node = nil, nil
+}
+
+// next returns the node that follows one without choices
+func (d *Dialogue) next(g *Game, node *DialogueNode) string {
+	for _, b := range node.Branches {
+		if holds(g, b.If) {
+			return b.Next
+		}
+	}
+	return node.Next
+}
+
+// showLine starts typing out one of the current node's lines
+func (d *Dialogue) showLine(g *Game, i int) {
+	d.CurrentLine = i
+	d.CharIndex = 0
+	d.AccumulatedFrames = 0
+	d.Finished = false
+	l := d.Node.line(i)
+	d.Speaker = ""
+	if sp, ok := g.speakers[l.Speaker]; ok {
+		d.Speaker = g.text(sp.Name)
+	}
+	d.Portrait = g.portrait(l.Speaker, l.Expression)
+	line := g.text(l.Text)
+	glyphs, err := richtext.Parse(line)
+	if err != nil {
+		// Lines are checked when they are loaded, but show something anyway
+		log.Println(err)
+		glyphs = richtext.Literal(line)
+	}
+	d.glyphs = glyphs
+	d.placed = richtext.Layout(glyphs, g.fface, dialogueTextWidth, dialogueLinesPerPage(g.fface))
+	d.pageStart = 0
+}
+
+// dialogueLinesPerPage returns how many lines of text fit in the box
+func dialogueLinesPerPage(face font.Face) int {
+	m := face.Metrics()
+	return 1 + (dialogueBoxHeight-dialogueTextY-m.Descent.Ceil())/m.Height.Ceil()
+}
+
+// pageEnd returns the index just past the last glyph on the current page
+func (d *Dialogue) pageEnd() int {
+	if d.pageStart >= len(d.placed) {
+		return len(d.placed)
+	}
+	return richtext.PageEnd(d.placed, d.pageStart)
+}
+
+// choosing reports whether the player is picking one of the choices
+func (d *Dialogue) choosing() bool {
+	return d.Finished && d.pageEnd() == len(d.glyphs) && d.CurrentLine == len(d.Node.Text)-1 && len(d.Choices) > 0
+}
+
+// Retranslate shows the current line again after the language changes. It
+// comes up in full, since the player has already seen the start of it.
+func (d *Dialogue) Retranslate(g *Game) {
+	if !d.IsOpen {
+		return
+	}
+	d.showLine(g, d.CurrentLine)
+	d.CharIndex = d.pageEnd()
+	d.Finished = true
+}
+
+// Finish ends the conversation straight away, as if the player read every
+// line and took the first choice each time, so the effects along the way
+// still happen
+func (d *Dialogue) Finish(g *Game) {
+	if !d.IsOpen {
+		return
+	}
+	// A conversation whose choices lead round in a circle never ends
+	for n := len(d.Tree.Nodes); d.IsOpen && n >= 0; n-- {
+		if len(d.Choices) > 0 {
+			d.enter(g, d.Choices[0].Next)
+		} else {
+			d.enter(g, d.next(g, d.Node))
+		}
+	}
+	d.IsOpen = false
+	d.Tree, d.Node = nil, nil
+}
+
+// Advance is what pressing Z does: show the rest of the page, turn the page,
+// go to the next line, or move the conversation on
+func (d *Dialogue) Advance(g *Game) {
+	if !d.Finished {
+		// Instantly display all characters on the current page
+		d.CharIndex = d.pageEnd()
+		d.Finished = true
+	} else if end := d.pageEnd(); end < len(d.glyphs) {
+		d.pageStart, d.CharIndex = end, end
+		d.AccumulatedFrames = 0
+		d.Finished = false
+	} else if d.CurrentLine < len(d.Node.Text)-1 {
+		d.showLine(g, d.CurrentLine+1)
+	} else if len(d.Choices) > 0 {
+		d.enter(g, d.Choices[d.Selected].Next)
+	} else {
+		d.enter(g, d.next(g, d.Node))
+	}
+}
+
 func (d *Dialogue) Update() {
-	if !d.IsOpen || d.Finished {
+	if !d.IsOpen {
+		return
+	}
+	d.frame++
+	if d.choosing() {
+		up, down := ebiten.IsKeyPressed(ebiten.KeyUp), ebiten.IsKeyPressed(ebiten.KeyDown)
+		if up && !d.keyUpPressedLastFrame {
+			d.Selected = (d.Selected + len(d.Choices) - 1) % len(d.Choices)
+		}
+		if down && !d.keyDownPressedLastFrame {
+			d.Selected = (d.Selected + 1) % len(d.Choices)
+		}
+		d.keyUpPressedLastFrame, d.keyDownPressedLastFrame = up, down
+	}
+	if d.Finished {
 		return
 	}
 
+	end := d.pageEnd()
+	if d.CharIndex >= end {
+		d.Finished = true
+		return
+	}
+	// Each glyph can wait longer before appearing, see package richtext
+	next := d.glyphs[d.CharIndex]
+	wait := d.FramesPerChar
+	if next.FramesPerChar > 0 {
+		wait = next.FramesPerChar
+	}
 	d.AccumulatedFrames++
-	if d.AccumulatedFrames >= d.FramesPerChar {
+	if d.AccumulatedFrames >= wait+next.Pause {
 		d.AccumulatedFrames = 0
 		d.CharIndex++
-		if d.CharIndex > len(d.TextLines[d.CurrentLine]) {
-			d.CharIndex = len(d.TextLines[d.CurrentLine])
+		if d.CharIndex >= end {
 			d.Finished = true
 		}
 	}
 }
 
-func (d *Dialogue) NextLine() {
-	if d.CurrentLine < len(d.TextLines)-1 {
-		d.CurrentLine++
-		d.CharIndex = 0
-		d.Finished = false
-	} else {
-		// No more lines, close the dialogue
-		d.IsOpen = false
-	}
-}
 func (d *Dialogue) Draw(screen *ebiten.Image, g *Game) {
 	if !d.IsOpen {
 		return
@@ -991,271 +814,142 @@ func (d *Dialogue) Draw(screen *ebiten.Image, g *Game) {
 
 	// Set up the dialogue box dimensions
 	boxWidth := screen.Bounds().Dx() - 20         // 10 pixels padding on each side
-	boxHeight := 63                               // Fixed height for the dialogue box
+	boxHeight := dialogueBoxHeight                // Fixed height for the dialogue box
 	boxX := 10                                    // X position of the box
 	boxY := screen.Bounds().Dy() - boxHeight - 10 // Y position of the box, 10 pixels above the bottom of the screen
 
 	// Draw the dialogue box background
-	dialogueBox := ebiten.NewImage(boxWidth, boxHeight)
-	dialogueBox.Fill(color.Black)
-	opts := &ebiten.DrawImageOptions{}
-	opts.GeoM.Translate(float64(boxX), float64(boxY))
-	screen.DrawImage(dialogueBox, opts)
-	charImg, _, err := ebitenutil.NewImageFromFile("assets/animBoy.png")
-	if err != nil {
-		log.Fatal(err)
+	gfx.FillRect(screen, float64(boxX), float64(boxY), float64(boxWidth), float64(boxHeight), color.Black)
+	if d.Portrait != nil {
+		charOpts := &ebiten.DrawImageOptions{}
+		charOpts.GeoM.Translate(float64(boxX), float64(boxY))
+		screen.DrawImage(d.Portrait, charOpts)
 	}
-	charOpts := &ebiten.DrawImageOptions{}
-	charOpts.GeoM.Translate(float64(boxX), float64(boxY))
-	screen.DrawImage(charImg, charOpts)
 	fontFace := g.fface
-	if err != nil {
-		log.Fatal(err)
+	// Draw the current page with the typewriter effect
+	richtext.Draw(screen, d.placed[d.pageStart:d.CharIndex], fontFace, boxX+dialogueTextX, boxY+dialogueTextY, color.White, d.frame)
+	if d.Finished && d.pageEnd() < len(d.glyphs) {
+		// More of this line to come
+		text.Draw(screen, "▼", fontFace, boxX+boxWidth-14, boxY+boxHeight-4, color.White)
 	}
-	// Draw the text with the typewriter effect
-	textToDisplay := d.TextLines[d.CurrentLine][:d.CharIndex]
-	text.Draw(screen, wrapText(textToDisplay, 225, fontFace), fontFace, boxX+70, boxY+17, color.White) // +10 for text padding, +30 to vertically center
-}
-func (g *Game) Draw(screen *ebiten.Image) {
-	if g.state == MenuState {
-		fontFace := g.fface
-		x := 4
-		y := 20
-		spacing := 20
-		for i, option := range g.menuOptions {
-			// Change color or style if option is selected
-			col := color.White
-			if i == g.selectedOption {
-				col = color.Black // Highlighted color
-			}
-			text.Draw(screen, option, fontFace, x, y+i*spacing, col)
-		}
-	} else if g.state == PlayState {
-		scale := 0.25
-		bgOpts := &ebiten.DrawImageOptions{}
-		bgOpts.GeoM.Translate(g.player.X, g.player.Y)
-		bgOpts.GeoM.Scale(scale, scale)
-		screen.DrawImage(g.Scenes[g.CurrentScene].Background, bgOpts)
-		currentSpriteSheet := g.player.SpriteSheets[g.player.Direction]
-		// 	// Determine the x, y location of the current frame on the sprite sheet
-		sx := (g.player.CurrentFrame % (currentSpriteSheet.Bounds().Dx() / g.player.FrameWidth)) * g.player.FrameWidth
-		sy := (g.player.CurrentFrame / (currentSpriteSheet.Bounds().Dx() / g.player.FrameWidth)) * g.player.FrameHeight
-
-		// 	// Create a sub-image that represents the current frame
-		frame := currentSpriteSheet.SubImage(image.Rect(sx, sy, sx+g.player.FrameWidth, sy+g.player.FrameHeight)).(*ebiten.Image)
-
-		// Draw the sub-image on the screen
-		opts := &ebiten.DrawImageOptions{}
-		// If the direction is left, flip the image on the vertical axis
-		if g.player.Direction == "left" {
-			opts.GeoM.Scale(-1, 1)                               // Flip horizontally
-			opts.GeoM.Translate(float64(g.player.FrameWidth), 0) // Adjust the position after flipping
-		}
-		if g.player.GhostMode {
-			var alpha float32 = 0.5
-			opts.ColorScale.Scale(1, 1, 1, alpha)
-		}
-		opts.GeoM.Scale(scale, scale)
-		//Draw Character at the center of the screen
-		screenWidth := screen.Bounds().Dx()
-		screenHeight := screen.Bounds().Dy()
-		charWidth := frame.Bounds().Dx()
-		charHeight := frame.Bounds().Dy()
-		charX := float64(screenWidth)/2 - float64(charWidth)/4
-		charY := float64(screenHeight)/2 - float64(charHeight)/4
-		opts.GeoM.Translate(charX, charY)
-		for _, cnpc := range g.Scenes[g.CurrentScene].NPCs {
-			cnpc.Draw(screen, g.player.X, g.player.Y, scale)
-		}
-		screen.DrawImage(frame, opts)
-		screen.DrawImage(g.Scenes[g.CurrentScene].Foreground, bgOpts)
-		g.dialogue.Draw(screen, g)
-		if g.player.GhostMode {
-			g.player.DrawGhostModeMeter(screen)
-		} else if g.player.GhostModeCooldown > 0 {
-			g.player.DrawGhostModeMeter(screen)
-		}
-	} else if g.state == TransitionState || g.state == NewSceneState {
-		scale := 0.25
-		bgOpts := &ebiten.DrawImageOptions{}
-		bgOpts.GeoM.Translate(g.player.X, g.player.Y)
-		bgOpts.GeoM.Scale(scale, scale)
-		screen.DrawImage(g.Scenes[g.CurrentScene].Background, bgOpts)
-		currentSpriteSheet := g.player.SpriteSheets[g.player.Direction]
-		// 	// Determine the x, y location of the current frame on the sprite sheet
-		sx := (g.player.CurrentFrame % (currentSpriteSheet.Bounds().Dx() / g.player.FrameWidth)) * g.player.FrameWidth
-		sy := (g.player.CurrentFrame / (currentSpriteSheet.Bounds().Dx() / g.player.FrameWidth)) * g.player.FrameHeight
-
-		// 	// Create a sub-image that represents the current frame
-		frame := currentSpriteSheet.SubImage(image.Rect(sx, sy, sx+g.player.FrameWidth, sy+g.player.FrameHeight)).(*ebiten.Image)
-
-		// Draw the sub-image on the screen
-		opts := &ebiten.DrawImageOptions{}
-		// If the direction is left, flip the image on the vertical axis
-		if g.player.Direction == "left" {
-			opts.GeoM.Scale(-1, 1)                               // Flip horizontally
-			opts.GeoM.Translate(float64(g.player.FrameWidth), 0) // Adjust the position after flipping
-		}
 
-		opts.GeoM.Scale(scale, scale)
-		//Draw Character at the center of the screen
-		screenWidth := screen.Bounds().Dx()
-		screenHeight := screen.Bounds().Dy()
-		charWidth := frame.Bounds().Dx()
-		charHeight := frame.Bounds().Dy()
-		charX := float64(screenWidth)/2 - float64(charWidth)/4
-		charY := float64(screenHeight)/2 - float64(charHeight)/4
-		opts.GeoM.Translate(charX, charY)
-		screen.DrawImage(frame, opts)
-		screen.DrawImage(g.Scenes[g.CurrentScene].Foreground, bgOpts)
-
-		// Draw the fade rectangle
-		fadeImage := ebiten.NewImage(screen.Bounds().Dx(), screen.Bounds().Dy())
-		fadeColor := color.RGBA{0, 0, 0, uint8(g.alpha * 0xff)} // Black with variable alpha
-		fadeImage.Fill(fadeColor)
-		screen.DrawImage(fadeImage, nil)
-	} else if g.state == CutsceneState {
-		scale := 0.25
-		bgOpts := &ebiten.DrawImageOptions{}
-		bgOpts.GeoM.Translate(g.player.X, g.player.Y)
-		bgOpts.GeoM.Scale(scale, scale)
-		screen.DrawImage(g.Scenes[g.CurrentScene].Background, bgOpts)
-		currentSpriteSheet := g.player.SpriteSheets[g.player.Direction]
-		// 	// Determine the x, y location of the current frame on the sprite sheet
-		sx := (g.player.CurrentFrame % (currentSpriteSheet.Bounds().Dx() / g.player.FrameWidth)) * g.player.FrameWidth
-		sy := (g.player.CurrentFrame / (currentSpriteSheet.Bounds().Dx() / g.player.FrameWidth)) * g.player.FrameHeight
-
-		// 	// Create a sub-image that represents the current frame
-		frame := currentSpriteSheet.SubImage(image.Rect(sx, sy, sx+g.player.FrameWidth, sy+g.player.FrameHeight)).(*ebiten.Image)
-
-		// Draw the sub-image on the screen
-		opts := &ebiten.DrawImageOptions{}
-		// If the direction is left, flip the image on the vertical axis
-		if g.player.Direction == "left" {
-			opts.GeoM.Scale(-1, 1)                               // Flip horizontally
-			opts.GeoM.Translate(float64(g.player.FrameWidth), 0) // Adjust the position after flipping
-		}
+	// Name of whoever is talking, on a tab above the box
+	if d.Speaker != "" {
+		tabWidth := font.MeasureString(fontFace, d.Speaker).Ceil() + 8
+		gfx.FillRect(screen, float64(boxX), float64(boxY-16), float64(tabWidth), 16, color.Black)
+		text.Draw(screen, d.Speaker, fontFace, boxX+4, boxY-4, color.RGBA{0xff, 0xd7, 0x00, 0xff})
+	}
 
-		opts.GeoM.Scale(scale, scale)
-		//Draw Character at the center of the screen
-		screenWidth := screen.Bounds().Dx()
-		screenHeight := screen.Bounds().Dy()
-		charWidth := frame.Bounds().Dx()
-		charHeight := frame.Bounds().Dy()
-		charX := float64(screenWidth)/2 - float64(charWidth)/4
-		charY := float64(screenHeight)/2 - float64(charHeight)/4
-		opts.GeoM.Translate(charX, charY)
-		for _, cnpc := range g.Scenes[g.CurrentScene].NPCs {
-			cnpc.Draw(screen, g.player.X, g.player.Y, scale)
-		}
-		screen.DrawImage(frame, opts)
-		screen.DrawImage(g.Scenes[g.CurrentScene].Foreground, bgOpts)
-		g.dialogue.Draw(screen, g)
-		fadeImage := ebiten.NewImage(screen.Bounds().Dx(), screen.Bounds().Dy())
-		fadeColor := color.RGBA{0, 0, 0, uint8(g.alpha * 0xff)} // Black with variable alpha
-		fadeImage.Fill(fadeColor)
-		screen.DrawImage(fadeImage, nil)
-	} else if g.state == TimeStopped {
-		scale := 0.25
-		bgOpts := &ebiten.DrawImageOptions{}
-		bgOpts.ColorScale.Scale(.5, .5, .5, 1)
-		bgOpts.GeoM.Translate(g.player.X, g.player.Y)
-		bgOpts.GeoM.Scale(scale, scale)
-		screen.DrawImage(g.Scenes[g.CurrentScene].Background, bgOpts)
-		currentSpriteSheet := g.player.SpriteSheets[g.player.Direction]
-		// 	// Determine the x, y location of the current frame on the sprite sheet
-		sx := (g.player.CurrentFrame % (currentSpriteSheet.Bounds().Dx() / g.player.FrameWidth)) * g.player.FrameWidth
-		sy := (g.player.CurrentFrame / (currentSpriteSheet.Bounds().Dx() / g.player.FrameWidth)) * g.player.FrameHeight
-
-		// 	// Create a sub-image that represents the current frame
-		frame := currentSpriteSheet.SubImage(image.Rect(sx, sy, sx+g.player.FrameWidth, sy+g.player.FrameHeight)).(*ebiten.Image)
-
-		// Draw the sub-image on the screen
-		opts := &ebiten.DrawImageOptions{}
-		// If the direction is left, flip the image on the vertical axis
-		if g.player.Direction == "left" {
-			opts.GeoM.Scale(-1, 1)                               // Flip horizontally
-			opts.GeoM.Translate(float64(g.player.FrameWidth), 0) // Adjust the position after flipping
+	// Choices, in a list above the right of the box with a marker on the selected one
+	if d.choosing() {
+		const lineHeight = 14
+		listWidth := 0
+		for _, c := range d.Choices {
+			if w := font.MeasureString(fontFace, g.text(c.Text)).Ceil(); w > listWidth {
+				listWidth = w
+			}
 		}
-
-		opts.GeoM.Scale(scale, scale)
-		//Draw Character at the center of the screen
-		screenWidth := screen.Bounds().Dx()
-		screenHeight := screen.Bounds().Dy()
-		charWidth := frame.Bounds().Dx()
-		charHeight := frame.Bounds().Dy()
-		charX := float64(screenWidth)/2 - float64(charWidth)/4
-		charY := float64(screenHeight)/2 - float64(charHeight)/4
-		opts.GeoM.Translate(charX, charY)
-		for _, cnpc := range g.Scenes[g.CurrentScene].NPCs {
-			cnpc.Draw(screen, g.player.X, g.player.Y, scale)
+		listWidth += 20
+		listHeight := len(d.Choices)*lineHeight + 6
+		listX := boxX + boxWidth - listWidth
+		listY := boxY - listHeight - 2
+		gfx.FillRect(screen, float64(listX), float64(listY), float64(listWidth), float64(listHeight), color.Black)
+		for i, c := range d.Choices {
+			y := listY + (i+1)*lineHeight
+			if i == d.Selected {
+				text.Draw(screen, ">", fontFace, listX+4, y, color.White)
+			}
+			text.Draw(screen, g.text(c.Text), fontFace, listX+14, y, color.White)
 		}
-		screen.DrawImage(frame, opts)
-		screen.DrawImage(g.Scenes[g.CurrentScene].Foreground, bgOpts)
-
 	}
-
 }
-
-func (g *Game) Layout(outsideWidth, outsideHeight int) (screenWidth, screenHeight int) {
-	return 320, 240
+func (g *Game) Layout(outsideWidth, outsideHeight int) (int, int) {
+	return screenWidth, screenHeight
 }
 
-func loadSpriteSheets() map[string]*ebiten.Image {
-	// Create a map to hold the sprite sheets
-	spriteSheets := make(map[string]*ebiten.Image)
-
-	// List of directions
-	directions := []string{"up", "down", "right", "left"}
+// Every character shares the player's clips, each with their own skin
+const animPath = "assets/player.anim.json"
 
-	// Loop over the directions and load the corresponding sprite sheet
-	for _, direction := range directions {
-		// Construct the file path for the sprite sheet
-		// This assumes you have files named like "playerUp.png", "playerDown.png", etc.
-		if direction == "left" {
-			spriteSheets["left"] = spriteSheets["right"]
-			break
-		}
-		c := cases.Upper(language.English)
-		path := "assets/player" + c.String(direction) + "Black" + ".png"
+// loadAnimation loads the character clips for a skin, e.g. "Black" or "Blue",
+// or the default one if skin is empty. A skin can also be a palette, which
+// recolours the art of its base skin.
+func loadAnimation(assets *asset.Manager, palettes map[string]*palette.Palette, skin string) (*anim.Animation, error) {
+	data, err := assets.ReadFile(animPath)
+	if err != nil {
+		return nil, err
+	}
+	pal, ok := palettes[skin]
+	if ok {
+		skin = pal.Base
+	}
+	a, err := anim.Load(data, skin, func(path string) (*ebiten.Image, error) {
+		return assets.Recolored(path, pal)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", animPath, err)
+	}
+	return a, nil
+}
 
-		// Load the image
-		img, _, err := ebitenutil.NewImageFromFile(path)
-		if err != nil {
-			log.Fatalf("failed to load '%s' sprite sheet: %v", direction, err)
-		}
+// Palettes for character skins and scenes
+const palettePath = "assets/palettes.json"
 
-		// Store the loaded image in the map
-		spriteSheets[direction] = img
+func loadPalettes(assets *asset.Manager) (map[string]*palette.Palette, error) {
+	data, err := assets.ReadFile(palettePath)
+	if err != nil {
+		return nil, err
 	}
-
-	return spriteSheets
+	palettes, err := palette.Load(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", palettePath, err)
+	}
+	return palettes, nil
 }
 
-func loadBackground(foregroundPath, backgroundPath string) (*ebiten.Image, *ebiten.Image) {
-	bgImage, _, err := ebitenutil.NewImageFromFile(backgroundPath)
+// loadBackground loads a scene's images, recoloured with pal unless it's nil
+func loadBackground(assets *asset.Manager, pal *palette.Palette, foregroundPath, backgroundPath string) (*ebiten.Image, *ebiten.Image, error) {
+	bgImage, err := assets.Recolored(backgroundPath, pal)
 	if err != nil {
-		log.Fatal(err)
+		return nil, nil, err
 	}
-	bgImage2, _, err := ebitenutil.NewImageFromFile(foregroundPath)
+	bgImage2, err := assets.Recolored(foregroundPath, pal)
 	if err != nil {
-		log.Fatal(err)
+		return nil, nil, err
 	}
-	return bgImage, bgImage2
+	return bgImage, bgImage2, nil
 }
 
 func (g *Game) AddObstacle(x1, y1, x2, y2 int) {
-	i := image.Rect(x1, y1, x2, y2)
-	g.Scenes[g.CurrentScene].obstacles = append(g.Scenes[g.CurrentScene].obstacles, &i)
+	r := collision.NewRect(float64(x1), float64(y1), float64(x2), float64(y2))
+	g.Scenes[g.CurrentScene].obstacles.Add(r)
 }
+
+// AddAirTightDiagonalObstacles blocks off a diagonal staircase of count boxes.
+// The staircase is stored as one shape, its convex hull, so the player slides
+// along it instead of catching on every step.
 func (g *Game) AddAirTightDiagonalObstacles(startX, startY, width, height, count int) {
+	var corners []collision.Vec
 	for i := 0; i < count; i++ {
-		x1 := startX + (width * i)
-		y1 := startY + (height * i)
-		x2 := x1 + width
-		y2 := y1 + height
-		g.AddObstacle(x1, y1, x2, y2)
+		x1 := float64(startX + (width * i))
+		y1 := float64(startY + (height * i))
+		x2 := x1 + float64(width)
+		y2 := y1 + float64(height)
+		corners = append(corners, collision.Vec{X: x1, Y: y1}, collision.Vec{X: x2, Y: y1}, collision.Vec{X: x1, Y: y2}, collision.Vec{X: x2, Y: y2})
 	}
+	g.Scenes[g.CurrentScene].obstacles.Add(collision.ConvexHull(corners))
+}
+
+// AddPolygonObstacle blocks off a convex polygon
+func (g *Game) AddPolygonObstacle(points []collision.Vec) {
+	g.Scenes[g.CurrentScene].obstacles.Add(collision.Polygon(points))
+}
+
+// AddLineObstacle adds a thin wall from x1, y1 to x2, y2
+func (g *Game) AddLineObstacle(x1, y1, x2, y2 int) {
+	g.Scenes[g.CurrentScene].obstacles.Add(collision.Segment{
+		A: collision.Vec{X: float64(x1), Y: float64(y1)},
+		B: collision.Vec{X: float64(x2), Y: float64(y2)},
+	})
 }
 
 func (g *Game) AddDoor(x1, y1, x2, y2 int, dest, id string, newX, newY float64) {
@@ -1269,219 +963,181 @@ func (g *Game) AddDoor(x1, y1, x2, y2 int, dest, id string, newX, newY float64)
 	}
 	g.Scenes[g.CurrentScene].doors = append(g.Scenes[g.CurrentScene].doors, d)
 }
-func (g *Game) AddNPC(spriteSheets map[string]*ebiten.Image, name string) {
-	n := &npc.NPC{
+func (g *Game) AddNPC(a *anim.Animation, name string, x, y float64) {
+	g.Scenes[g.CurrentScene].NPCs = append(g.Scenes[g.CurrentScene].NPCs, newNPC(a, name, x, y))
+}
+
+func newNPC(a *anim.Animation, name string, x, y float64) *npc.NPC {
+	return &npc.NPC{
 		Name:             name,
-		X:                -900,
-		Y:                -950,
-		FrameWidth:       192 / 4, // The width of a single frame
-		FrameHeight:      68,      // The height of a single frame
-		FrameCount:       4,       // The total number of frames in the sprite sheet
-		SpriteSheets:     spriteSheets,
+		X:                x,
+		Y:                y,
+		Anim:             anim.NewAnimator(a, "idle_left"),
 		Direction:        "left", // Default direction
 		Speed:            7.0,
 		MoveTimer:        60,  // 1 second at 60 FPS
 		StopDuration:     120, // stops for 3 seconds
 		IsStopped:        true,
 		InteractionState: npc.NoInteraction,
-		DialogueText:     []string{"Lets go on a trip together! How much dialogue do you need?", "Liten up fella, I really hate doing this, but you kind of smell like rotten eggs took a piss in a toilet."},
 	}
-	g.Scenes[g.CurrentScene].NPCs = append(g.Scenes[g.CurrentScene].NPCs, n)
 }
 func newScene(foreground *ebiten.Image, background *ebiten.Image, fn, fn2 func(*Game)) *Scene {
 	return &Scene{
+		obstacles:     collision.NewWorld(collision.DefaultCellSize),
 		Foreground:    foreground,
 		Background:    background,
 		loadObsnDoors: fn,
 		loadNPCs:      fn2,
 	}
 }
-func (g *Game) loadScenes() {
-	m := make(map[string]*Scene)
-	bg1, fg1 := loadBackground("assets/mainMap.png", "assets/over.png")
-	bg2, fg2 := loadBackground("assets/mainMapRed.png", "assets/overRed.png")
-	mainScene := newScene(bg1, fg1, loadObsnDoorss, loadNPCBryan)
-	secondScene := newScene(bg2, fg2, loadObsnDoors2, loadNPCBryan)
-	mainScene.Game = g
-	secondScene.Game = g
-	g.Scenes = m
 
-	m["mainMap"] = mainScene
-	m["mainMapRed"] = secondScene
+// loadContent reads everything the game needs besides the save file
+func (g *Game) loadContent() error {
+	if err := g.loadLocale(); err != nil {
+		return err
+	}
+	if err := g.loadScenes(); err != nil {
+		return err
+	}
+	g.loadSpeakers()
+	return g.loadCutscenes()
 }
 
-func (g *Game) changeScene(from string, to string) {
-	g.CurrentScene = to
-}
-func loadNPCBryan(g *Game) {
-	if len(g.Scenes[g.CurrentScene].NPCs) == 0 {
-
-		// Create a map to hold the sprite sheets
-		spriteSheets := make(map[string]*ebiten.Image)
-
-		// List of directions
-		directions := []string{"up", "down", "right", "left"}
-
-		// Loop over the directions and load the corresponding sprite sheet
-		for _, direction := range directions {
-			// Construct the file path for the sprite sheet
-			// This assumes you have files named like "playerUp.png", "playerDown.png", etc.
-			if direction == "left" {
-				spriteSheets["left"] = spriteSheets["right"]
-				break
+func (g *Game) loadScenes() error {
+	defs, err := loadSceneFiles(g.assets, sceneDir)
+	if err != nil {
+		return err
+	}
+	m := make(map[string]*Scene)
+	for name, def := range defs {
+		var pal *palette.Palette
+		if def.Palette != "" {
+			if pal = g.palettes[def.Palette]; pal == nil {
+				return fmt.Errorf("scene %q: unknown palette %q", name, def.Palette)
 			}
-			c := cases.Upper(language.English)
-			path := "assets/player" + c.String(direction) + "Blue" + ".png"
-
-			// Load the image
-			img, _, err := ebitenutil.NewImageFromFile(path)
-			if err != nil {
-				log.Fatalf("failed to load '%s' sprite sheet: %v", direction, err)
+		}
+		var bg, fg *ebiten.Image
+		if def.tiledMap != nil {
+			bg, fg, err = renderTiledMap(g.assets, pal, def.tiledMap)
+		} else {
+			bg, fg, err = loadBackground(g.assets, pal, def.Foreground, def.Background)
+		}
+		if err != nil {
+			return fmt.Errorf("scene %q: %v", name, err)
+		}
+		// Load the NPCs' sheets now so a missing one is reported at startup
+		for _, n := range def.NPCs {
+			if _, err := loadAnimation(g.assets, g.palettes, n.Skin); err != nil {
+				return fmt.Errorf("scene %q: npc %s: %v", name, n.Name, err)
 			}
-
-			// Store the loaded image in the map
-			spriteSheets[direction] = img
 		}
-
-		g.AddNPC(spriteSheets, "Bryan")
+		fg, props := cutProps(fg, def.Props)
+		s := newScene(fg, bg, def.loadObsnDoors, def.loadNPCs)
+		s.props = props
+		s.Name = name
+		s.Game = g
+		s.def = def
+		m[name] = s
 	}
+	g.Scenes = m
+	return nil
 }
-func loadObsnDoorss(g *Game) {
-	if len(g.Scenes[g.CurrentScene].obstacles) == 0 {
-		g.AddObstacle(2075, 432, 1850, 604) // House Collision
-		g.AddObstacle(956, 630, 1430, 855)
-		g.AddObstacle(2340, 432, 2550, 604)
-		g.AddObstacle(540, 715, 620, 800) // Tree Collision
-		g.AddObstacle(580, 520, 660, 610)
-		g.AddObstacle(680, 950, 755, 1040)
-		g.AddObstacle(920, 430, 1000, 515)
-		g.AddObstacle(1495, 430, 1575, 515)
-		g.AddObstacle(875, 665, 955, 745)
-		g.AddObstacle(1160, 815, 1235, 900)
-		g.AddObstacle(1210, 485, 1290, 565)
-		g.AddObstacle(1680, 485, 1765, 565)
-		g.AddObstacle(1495, 435, 1575, 515)
-		g.AddObstacle(1450, 670, 1530, 750)
-		g.AddObstacle(2260, 465, 2350, 550)
-		g.AddObstacle(2555, 465, 2640, 550)
-		g.AddObstacle(225, 680, 270, 770)
-		g.AddAirTightDiagonalObstacles(275, 780, 30, 30, 10)
-		g.AddAirTightDiagonalObstacles(615, 1070, 30, 30, 7)
-		g.AddAirTightDiagonalObstacles(250, 665, 30, -30, 10)
-		g.AddAirTightDiagonalObstacles(2400, 1270, 30, -30, 13)
-		g.AddAirTightDiagonalObstacles(2515, 355, 30, 30, 10)
-		g.AddObstacle(815, 1240, 2410, 1295) //Land boundary Collision
-		g.AddObstacle(575, 305, 2520, 335)
-		g.AddObstacle(975, 1060, 2520, 1100) //Fence Collision
-		g.AddObstacle(1415, 930, 1895, 955)
-		g.AddObstacle(2030, 930, 2380, 955)
-		g.AddObstacle(2830, 645, 3060, 670) // Port Collisions
-		g.AddObstacle(2835, 815, 3060, 835)
-		g.AddObstacle(3060, 670, 3085, 815)
-		g.AddObstacle(2170, 705, 2300, 850)                           // Pond Collisions
-		g.AddDoor(1000, 840, 1095, 945, "mainMapRed", "fd", -140, 20) // Door Collisions
-		g.AddDoor(1290, 840, 1390, 945, "mainMapRed", "sd", -1000, -1000)
-		g.AddDoor(1915, 600, 2015, 710, "mainMapRed", "td", -1500, -1500)
-		g.AddDoor(2400, 600, 2495, 710, "mainMapRed", "ffd", -700, -700)
-	}
 
-}
-func loadObsnDoors2(g *Game) {
-	if len(g.Scenes[g.CurrentScene].obstacles) == 0 {
-		g.AddObstacle(2075, 432, 1850, 604) // House Collision
-		g.AddObstacle(956, 630, 1430, 855)
-		g.AddObstacle(2340, 432, 2550, 604)
-		g.AddObstacle(540, 715, 620, 800) // Tree Collision
-		g.AddObstacle(580, 520, 660, 610)
-		g.AddObstacle(680, 950, 755, 1040)
-		g.AddObstacle(920, 430, 1000, 515)
-		g.AddObstacle(1495, 430, 1575, 515)
-		g.AddObstacle(875, 665, 955, 745)
-		g.AddObstacle(1160, 815, 1235, 900)
-		g.AddObstacle(1210, 485, 1290, 565)
-		g.AddObstacle(1680, 485, 1765, 565)
-		g.AddObstacle(1495, 435, 1575, 515)
-		g.AddObstacle(1450, 670, 1530, 750)
-		g.AddObstacle(2260, 465, 2350, 550)
-		g.AddObstacle(2555, 465, 2640, 550)
-		g.AddObstacle(225, 680, 270, 770)
-		g.AddAirTightDiagonalObstacles(275, 780, 30, 30, 10)
-		g.AddAirTightDiagonalObstacles(615, 1070, 30, 30, 7)
-		g.AddAirTightDiagonalObstacles(250, 665, 30, -30, 10)
-		g.AddAirTightDiagonalObstacles(2400, 1270, 30, -30, 13)
-		g.AddAirTightDiagonalObstacles(2515, 355, 30, 30, 10)
-		g.AddObstacle(815, 1240, 2410, 1295) //Land boundary Collision
-		g.AddObstacle(575, 305, 2520, 335)
-		g.AddObstacle(975, 1060, 2520, 1100) //Fence Collision
-		g.AddObstacle(1415, 930, 1895, 955)
-		g.AddObstacle(2030, 930, 2380, 955)
-		g.AddObstacle(2830, 645, 3060, 670) // Port Collisions
-		g.AddObstacle(2835, 815, 3060, 835)
-		g.AddObstacle(3060, 670, 3085, 815)
-		g.AddObstacle(2170, 705, 2300, 850)                          // Pond Collisions
-		g.AddDoor(1000, 840, 1095, 945, "mainMap", "fd", -500, -500) // Door Collisions
-		g.AddDoor(1290, 840, 1390, 945, "mainMap", "sd", -1000, -1000)
-		g.AddDoor(1915, 600, 2015, 710, "mainMap", "td", -1500, -1500)
-		g.AddDoor(2400, 600, 2495, 710, "mainMap", "ffd", -700, -700)
+// loadCutscenes reads the dialogue trees and cutscene scripts, checking the
+// actors they use against the NPCs placed in the scene files
+func (g *Game) loadCutscenes() error {
+	db, err := loadDialogueDB(g.assets, dialogueDir)
+	if err != nil {
+		return err
 	}
 
+	defs := make(map[string]*SceneFile)
+	for name, s := range g.Scenes {
+		defs[name] = s.def
+	}
+	env := newScriptEnv(defs, db)
+	scripts, err := loadCutscenes(g.assets, cutsceneDir, env)
+	if err != nil {
+		return err
+	}
+	if err := db.checkCutscenes(scripts); err != nil {
+		return err
+	}
+	if err := g.checkSpeakers(db); err != nil {
+		return err
+	}
+	if err := g.checkUsedStrings(usedStrings(defs, db, env)); err != nil {
+		return err
+	}
+	g.dialogues = db
+	g.cutscenes = scripts
+	if g.playedCutscenes == nil {
+		g.playedCutscenes = make(map[string]bool)
+	}
+	return nil
 }
-func wrapText(text string, maxWidth int, face font.Face) string {
-	var wrapped string
-	var lineWidth fixed.Int26_6
-	spaceWidth := font.MeasureString(face, " ")
-
-	for _, word := range strings.Fields(text) {
-		wordWidth := font.MeasureString(face, word)
-
-		// If adding the new word exceeds the max width, then insert a new line
-		if lineWidth > 0 && lineWidth+wordWidth+spaceWidth > fixed.I(maxWidth) {
-			wrapped += "\n"
-			lineWidth = 0
-		}
 
-		if lineWidth > 0 {
-			wrapped += " "
-			lineWidth += spaceWidth
-		}
+func (g *Game) changeScene(from string, to string) {
+	g.CurrentScene = to
+}
 
-		wrapped += word
-		lineWidth += wordWidth
+// enterScene moves the player to x, y in another scene, loading the scene's
+// obstacles, doors and NPCs if this is the first visit. Doors and cutscenes
+// both come through here, so it's also where arriving somewhere counts.
+func (g *Game) enterScene(name string, x, y float64) {
+	g.changeScene(g.CurrentScene, name)
+	if name == "mainMapRed" {
+		g.Progress.HasVisitedRedTown = true
 	}
-
-	return wrapped
+	g.player.X = x
+	g.player.Y = y
+	g.Scenes[g.CurrentScene].loadObsnDoors(g)
+	g.Scenes[g.CurrentScene].loadNPCs(g)
+	g.resetCamera()
 }
 func NewGame() *Game {
-	// Load the sprite sheet
-	spriteSheets := loadSpriteSheets()
+	// Load the player's animation
+	assets := newAssets()
+	palettes, err := loadPalettes(assets)
+	if err != nil {
+		log.Fatal(err)
+	}
+	a, err := loadAnimation(assets, palettes, playerSkin)
+	if err != nil {
+		log.Fatal(err)
+	}
 	f, err := loadFontFace()
 	if err != nil {
 		log.Fatal(err)
 	}
 	// Create an instance of the Game struct
 	g := &Game{
-		state:          PlayState,
+		state:          MenuState,
+		assets:         assets,
+		palettes:       palettes,
 		fface:          f,
-		menuOptions:    []string{"Start Game", "Options", "Exit"},
+		menuOptions:    mainMenu,
 		selectedOption: 0,
 		alpha:          0.0,
 		fadeSpeed:      0.05,
+		camera:         camera.New(screenWidth, screenHeight, worldZoom),
 		player: &player.Player{
-			X:            0,
-			Y:            0,
-			FrameWidth:   192 / 4, // The width of a single frame
-			FrameHeight:  68,      // The height of a single frame
-			FrameCount:   4,       // The total number of frames in the sprite sheet
-			SpriteSheets: spriteSheets,
-			Direction:    "down", // Default direction
-			Speed:        7.0,
-			CanMove:      true,
+			X:         592,
+			Y:         412,
+			Anim:      anim.NewAnimator(a, "idle_down"),
+			Skin:      playerSkin,
+			Direction: "down", // Default direction
+			Speed:     7.0,
+			CanMove:   true,
 		},
 	}
-	g.loadScenes()
+	if err := g.loadContent(); err != nil {
+		log.Fatal(err)
+	}
 	g.CurrentScene = "mainMap"
 	g.Scenes[g.CurrentScene].loadObsnDoors(g)
 	g.Scenes[g.CurrentScene].loadNPCs(g)
+	g.resetCamera()
 	g.dialogue = newDialogue()
 	// g.AddObstacle(0, 0, 300, 300)       // Debug collision box
 
@@ -1491,7 +1147,6 @@ func NewGame() *Game {
 }
 func newDialogue() *Dialogue {
 	d := &Dialogue{
-		TextLines:     []string{},
 		FramesPerChar: 2, // For example, one character every 2 frames
 		IsOpen:        false,
 		CurrentLine:   0,
@@ -1500,15 +1155,55 @@ func newDialogue() *Dialogue {
 	return d
 
 }
+
+// Where the game's files come from. Builds with -tags embed carry them in
+// the binary, see embed.go, otherwise they are read from the working
+// directory.
+var gameFS fs.FS
+
+func newAssets() *asset.Manager {
+	if gameFS != nil {
+		return asset.New(gameFS)
+	}
+	return asset.Disk(".")
+}
+
+// Main menu entries, as string IDs. Game.Update handles them by position.
+var mainMenu = []string{"menu.start", "menu.language", "menu.options", "menu.exit"}
+
 func main() {
+	checkLangFlag := flag.Bool("checklang", false, "list missing and unused strings in the string tables, then exit")
+	devFlag := flag.Bool("dev", false, "start a new game and reload scenes, sprites, dialogue and strings when their files change")
+	allocsFlag := flag.Bool("allocs", false, "play a new game through each state and log how much it allocates per frame, then exit")
+	flag.Parse()
+	if *checkLangFlag {
+		os.Exit(checkLang())
+	}
+
 	var game *Game
-	if savedStateExists("savefile.json") {
+	if *allocsFlag {
+		game = NewGame()
+	} else if !*devFlag && savedStateExists("savefile.json") {
+		// Dev mode starts a new game, so changes to where things start show up
 		gameState, err := LoadGameState("savefile.json")
 		if err != nil {
 			log.Fatalf("Failed to load saved game: %v", err)
 		}
 		f, err := loadFontFace()
-		spriteSheets := loadSpriteSheets()
+		if err != nil {
+			log.Fatal(err)
+		}
+		assets := newAssets()
+		skin := gameState.PlayerSkin
+		if skin == "" {
+			// Saved before the skin was
+			skin = playerSkin
+		}
+		palettes, err := loadPalettes(assets)
+		if err != nil {
+			log.Fatal(err)
+		}
+		a, err := loadAnimation(assets, palettes, skin)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -1516,43 +1211,74 @@ func main() {
 			&Game{
 				CurrentScene:   gameState.CurrentScene,
 				Progress:       gameState.GameProgress,
-				state:          PlayState,
+				state:          MenuState,
+				assets:         assets,
+				palettes:       palettes,
 				fface:          f,
-				menuOptions:    []string{"Start Game", "Options", "Exit"},
+				menuOptions:    mainMenu,
 				selectedOption: 0,
 				alpha:          0.0,
 				fadeSpeed:      0.05,
+				camera:         camera.New(screenWidth, screenHeight, worldZoom),
 				player: &player.Player{
 					X:              gameState.PlayerPosition.X,
 					Y:              gameState.PlayerPosition.Y,
-					FrameWidth:     192 / 4, // The width of a single frame
-					FrameHeight:    68,      // The height of a single frame
-					FrameCount:     4,       // The total number of frames in the sprite sheet
-					SpriteSheets:   spriteSheets,
+					Anim:           anim.NewAnimator(a, "idle_"+gameState.PlayerDirection),
+					Skin:           skin,
 					Direction:      gameState.PlayerDirection, // Default direction
 					Speed:          7.0,
 					CanMove:        true,
 					GhostModeMeter: 600,
 				},
 			}
-		game.loadScenes()
+		if err := game.loadContent(); err != nil {
+			log.Fatal(err)
+		}
 		game.Scenes[game.CurrentScene].loadObsnDoors(game)
 		game.Scenes[game.CurrentScene].loadNPCs(game)
+		game.placeNPCs(gameState.NPCPositions)
+		game.resetCamera()
 		game.dialogue = newDialogue()
 	} else {
 		game = NewGame()
 	}
+	if *devFlag {
+		game.startDevMode()
+	}
 
 	// Configuration settings
 	ebiten.SetWindowSize(640, 480)
 	ebiten.SetWindowTitle("Sprite Animation")
 
 	// Start the game
-	if err := ebiten.RunGame(game); err != nil {
+	var run ebiten.Game = game
+	if *allocsFlag {
+		run = newAllocBench(game)
+	}
+	if err := ebiten.RunGame(run); err != nil {
 		log.Fatal(err)
 	}
 }
 
+// npcPositions lists where each NPC is, for saving
+func npcPositions(npcs []*npc.NPC) []Vector2D {
+	positions := make([]Vector2D, len(npcs))
+	for i, n := range npcs {
+		positions[i] = Vector2D{X: n.X, Y: n.Y}
+	}
+	return positions
+}
+
+// placeNPCs moves the current scene's NPCs back to where a save had them.
+// NPCs the save doesn't cover stay where the scene file puts them.
+func (g *Game) placeNPCs(positions []Vector2D) {
+	for i, n := range g.Scenes[g.CurrentScene].NPCs {
+		if i < len(positions) {
+			n.X, n.Y = positions[i].X, positions[i].Y
+		}
+	}
+}
+
 func savedStateExists(filename string) bool {
 	_, err := os.Stat(filename)
 	return !os.IsNotExist(err)
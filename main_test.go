@@ -0,0 +1,195 @@
+package main
+
+import (
+	"ebi/anim"
+	"ebi/asset"
+	"ebi/camera"
+	"ebi/npc"
+	"ebi/player"
+	"ebi/richtext"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// newTestGame makes a game with an empty mainMap and mainMapRed, enough for
+// code that moves the player around and between scenes or talks. Strings and
+// dialogue come from the game's own files.
+func newTestGame(t *testing.T) *Game {
+	t.Helper()
+	g := &Game{
+		player:       &player.Player{Anim: anim.NewAnimator(&anim.Animation{FrameWidth: 48, FrameHeight: 68}, "")},
+		state:        PlayState,
+		fadeSpeed:    0.05,
+		Scenes:       make(map[string]*Scene),
+		CurrentScene: "mainMap",
+		camera:       camera.New(screenWidth, screenHeight, worldZoom),
+		dialogue:     newDialogue(),
+		assets:       asset.Disk("."),
+	}
+	var err error
+	if g.fface, err = loadFontFace(); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.loadLocale(); err != nil {
+		t.Fatal(err)
+	}
+	if g.dialogues, err = loadDialogueDB(g.assets, dialogueDir); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"mainMap", "mainMapRed"} {
+		g.Scenes[name] = &Scene{
+			Name:          name,
+			Game:          g,
+			Background:    ebiten.NewImage(200, 200),
+			loadObsnDoors: func(*Game) {},
+			loadNPCs:      func(*Game) {},
+		}
+	}
+	return g
+}
+
+// Walking through a door and a cutscene's changescene step both count as
+// visiting the red town, and visiting anywhere else doesn't
+func TestEnterSceneVisitsRedTown(t *testing.T) {
+	g := newTestGame(t)
+	g.enterScene("mainMap", 10, 20)
+	if g.Progress.HasVisitedRedTown {
+		t.Error("entering mainMap set HasVisitedRedTown")
+	}
+	if g.player.X != 10 || g.player.Y != 20 {
+		t.Errorf("player at %v,%v, want 10,20", g.player.X, g.player.Y)
+	}
+
+	g = newTestGame(t)
+	g.alpha = 1 // Already faded out, so the step switches straight away
+	a := &ChangeSceneAction{Scene: "mainMapRed", Spawn: Vector2D{30, 40}}
+	a.Start(g)
+	a.Update(g)
+	if g.CurrentScene != "mainMapRed" || !g.Progress.HasVisitedRedTown {
+		t.Errorf("changescene left the game in %s with HasVisitedRedTown %v", g.CurrentScene, g.Progress.HasVisitedRedTown)
+	}
+}
+
+// NPCs that moved, e.g. in a cutscene, are back in the same place after
+// saving and loading
+func TestSaveNPCPositions(t *testing.T) {
+	g := newTestGame(t)
+	g.Scenes["mainMap"].NPCs = []*npc.NPC{{Name: "Bryan", X: 10, Y: 20}, {Name: "Sam", X: 30, Y: 40}}
+	path := filepath.Join(t.TempDir(), "save.json")
+	s := &SaveState{
+		Version:      saveVersion,
+		CurrentScene: g.CurrentScene,
+		NPCPositions: npcPositions(g.Scenes["mainMap"].NPCs),
+	}
+	if err := SaveGameState(s, path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadGameState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A fresh game puts the NPCs where the scene file says
+	g = newTestGame(t)
+	g.Scenes["mainMap"].NPCs = []*npc.NPC{{Name: "Bryan"}, {Name: "Sam"}, {Name: "Cat", X: 5, Y: 5}}
+	g.placeNPCs(loaded.NPCPositions)
+	want := []Vector2D{{10, 20}, {30, 40}, {5, 5}}
+	for i, n := range g.Scenes["mainMap"].NPCs {
+		if n.X != want[i].X || n.Y != want[i].Y {
+			t.Errorf("%s at %v,%v, want %v", n.Name, n.X, n.Y, want[i])
+		}
+	}
+}
+
+// Every line of a page fits in the dialogue box, and a long line is shown
+// a page at a time
+func TestDialoguePages(t *testing.T) {
+	g := newTestGame(t)
+	m := g.fface.Metrics()
+	perPage := dialogueLinesPerPage(g.fface)
+	bottom := func(lines int) int {
+		return dialogueTextY + (lines-1)*m.Height.Ceil() + m.Descent.Ceil()
+	}
+	if perPage < 1 || bottom(perPage) > dialogueBoxHeight || bottom(perPage+1) <= dialogueBoxHeight {
+		t.Fatalf("%d lines a page in a %dpx box, their bottom at %d", perPage, dialogueBoxHeight, bottom(perPage))
+	}
+
+	long := strings.Repeat("All work and no play makes a dull dialogue box. ", 8)
+	g.dialogue.Open(g, LinesTree("", []string{long}))
+	d := g.dialogue
+	pages := 0
+	for start := 0; start < len(d.placed); start = richtext.PageEnd(d.placed, start) {
+		for _, p := range d.placed[start:richtext.PageEnd(d.placed, start)] {
+			if p.Line >= perPage {
+				t.Fatalf("%q on line %d of page %d", p.Text, p.Line, p.Page)
+			}
+		}
+		pages++
+	}
+	if pages < 2 {
+		t.Fatalf("%d characters fit on one page", len(long))
+	}
+
+	// Z shows the rest of the page, then turns it
+	for i := 0; i < pages; i++ {
+		d.Advance(g)
+		if !d.Finished || d.CharIndex != d.pageEnd() || d.placed[d.pageStart].Page != i {
+			t.Fatalf("page %d not shown in full", i)
+		}
+		if i < pages-1 {
+			d.Advance(g)
+		}
+	}
+	d.Advance(g)
+	if d.IsOpen {
+		t.Error("dialogue open after the last page")
+	}
+}
+
+// Changing the language from the menu changes the menu's own labels and the
+// line of an open conversation
+func TestChangeLanguage(t *testing.T) {
+	g := newTestGame(t)
+	g.dialogue.Open(g, LinesTree("", []string{"@bryan.greeting.1"}))
+	english := richtext.Plain(g.dialogue.glyphs)
+	menu := g.menuLabel("menu.language")
+
+	g.locale.NextLanguage()
+	g.dialogue.Retranslate(g)
+	if got, want := g.menuLabel("menu.language"), fmt.Sprintf(g.locale.T("menu.language"), g.locale.T("language.name")); got != want || got == menu {
+		t.Errorf("menu says %q after changing language from %q", got, menu)
+	}
+	if got, want := richtext.Plain(g.dialogue.glyphs), g.text("@bryan.greeting.1"); got == english || got != want {
+		t.Errorf("dialogue says %q, want %q", got, want)
+	}
+	if !g.dialogue.Finished || g.dialogue.CharIndex == 0 {
+		t.Error("retranslated line isn't shown in full")
+	}
+}
+
+// Blue and Green are palettes over the Black art, so they load without
+// sheets of their own
+func TestLoadAnimation(t *testing.T) {
+	assets := asset.Disk(".")
+	palettes, err := loadPalettes(assets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for skin, want := range map[string]string{"": anim.DefaultSkin, "Black": "Black", "Blue": "Black", "Green": "Black"} {
+		a, err := loadAnimation(assets, palettes, skin)
+		if err != nil {
+			t.Errorf("skin %q: %v", skin, err)
+			continue
+		}
+		if a.Skin != want {
+			t.Errorf("skin %q loaded the %s art", skin, a.Skin)
+		}
+	}
+	if _, err := loadAnimation(assets, palettes, "Purple"); err == nil {
+		t.Errorf("loaded a skin with neither art nor a palette")
+	}
+}
@@ -1,8 +1,9 @@
 package npc
 
 import (
+	"ebi/anim"
+	"ebi/camera"
 	"fmt"
-	"image"
 
 	"github.com/hajimehoshi/ebiten/v2"
 )
@@ -18,17 +19,13 @@ const (
 
 type NPC struct {
 	Name             string
-	FrameWidth       int
-	FrameHeight      int
-	FrameCount       int
-	CurrentFrame     int
+	Anim             *anim.Animator
+	Skin             string // Picks the sprite sheets and portraits, e.g. "Blue"
 	MoveTimer        int
 	StopTimer        int
 	IsStopped        bool
 	StopDuration     int
-	TickCount        int // Counter to track the number of updates
-	X, Y             float64
-	SpriteSheets     map[string]*ebiten.Image // Map of sprite sheets for each direction
+	X, Y             float64 // World position of the top left of the sprite
 	Direction        string
 	Speed            float64
 	DialogueText     []string
@@ -38,15 +35,33 @@ type NPC struct {
 func (npc *NPC) Move(dir string) {
 	switch dir {
 	case "left":
-		npc.X += npc.Speed // Move left
+		npc.X -= npc.Speed // Move left
 	case "right":
-		npc.X -= npc.Speed // Move right
+		npc.X += npc.Speed // Move right
 	case "up":
-		npc.Y += npc.Speed // Move up
+		npc.Y -= npc.Speed // Move up
 	case "down":
-		npc.Y -= npc.Speed // Move down
+		npc.Y += npc.Speed // Move down
 	}
-	npc.TickCount++
+}
+
+// Position, SetPosition, Face, Size and Walk let cutscenes move NPCs and the
+// player around the same way
+
+func (npc *NPC) Position() (float64, float64) { return npc.X, npc.Y }
+func (npc *NPC) SetPosition(x, y float64)     { npc.X, npc.Y = x, y }
+func (npc *NPC) Face(dir string)              { npc.Direction = dir }
+func (npc *NPC) Size() (int, int)             { return npc.Anim.Size() }
+
+// Walk plays the walking animation while moving is true and the idle one
+// otherwise, and advances it a tick
+func (npc *NPC) Walk(moving bool) {
+	clip := "idle"
+	if moving {
+		clip = "walk"
+	}
+	npc.Anim.PlayDir(clip, npc.Direction)
+	npc.Anim.Update()
 }
 
 func (npc *NPC) Update(interactionKey ebiten.Key) {
@@ -58,6 +73,7 @@ func (npc *NPC) Update(interactionKey ebiten.Key) {
 	}
 
 	// NPC movement logic
+	moving := false
 	if npc.InteractionState == NoInteraction {
 		if npc.IsStopped {
 			// NPC is stopped, so we might count down the stop timer
@@ -77,6 +93,7 @@ func (npc *NPC) Update(interactionKey ebiten.Key) {
 		} else {
 			npc.MoveTimer--
 			npc.Move(npc.Direction)
+			moving = true
 			if npc.MoveTimer <= 0 {
 				// Time to stop
 				npc.IsStopped = true
@@ -89,33 +106,16 @@ func (npc *NPC) Update(interactionKey ebiten.Key) {
 		fmt.Println("In a cutscene")
 	}
 
-	if npc.TickCount >= 10 {
-		npc.CurrentFrame = (npc.CurrentFrame + 1) % npc.FrameCount
-		npc.TickCount = 0 // Reset the tick count
-	}
+	npc.Walk(moving)
 }
 
-func (npc *NPC) Draw(screen *ebiten.Image, pX, pY float64, scale float64) {
-	currentSpriteSheet := npc.SpriteSheets[npc.Direction]
-
-	// 	// Determine the x, y location of the current frame on the sprite sheet
-	sx := (npc.CurrentFrame % (currentSpriteSheet.Bounds().Dx() / npc.FrameWidth)) * npc.FrameWidth
-	sy := (npc.CurrentFrame / (currentSpriteSheet.Bounds().Dx() / npc.FrameWidth)) * npc.FrameHeight
-
-	// 	// Create a sub-image that represents the current frame
-	frame := currentSpriteSheet.SubImage(image.Rect(sx, sy, sx+npc.FrameWidth, sy+npc.FrameHeight)).(*ebiten.Image)
-
-	// Draw the sub-image on the screen
-	opts := &ebiten.DrawImageOptions{}
-	// If the direction is left, flip the image on the vertical axis
-	if npc.Direction == "left" {
-		opts.GeoM.Scale(-1, 1)                          // Flip horizontally
-		opts.GeoM.Translate(float64(npc.FrameWidth), 0) // Adjust the position after flipping
-	}
-	fX := pX - npc.X
-	fY := pY - npc.Y
-	opts.GeoM.Translate(fX, fY)
-	opts.GeoM.Scale(scale, scale)
+// SortY returns where the NPC's feet are, for drawing things lower down the
+// screen in front
+func (npc *NPC) SortY() float64 {
+	_, h := npc.Size()
+	return npc.Y + float64(h)
+}
 
-	screen.DrawImage(frame, opts)
+func (npc *NPC) Draw(screen *ebiten.Image, cam *camera.Camera) {
+	npc.Anim.Draw(screen, npc.X, npc.Y, cam, nil)
 }
@@ -0,0 +1,121 @@
+// Package palette recolours images, so one sprite sheet or map can be shown in
+// several colour schemes without a copy of the art for each. A palette swaps
+// exact colours for others and can turn the hue of the colours it doesn't
+// swap. Palettes are described in JSON, keyed by name:
+//
+//	{
+//	  "Green": {"base": "Black", "swaps": {"#090010": "#0a3c14", "#222222": "#285a32"}},
+//	  "Dusk": {"hue": 300}
+//	}
+//
+// Base is the skin whose art a character palette recolours, see package anim.
+package palette
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type Palette struct {
+	Name  string
+	Base  string // Skin with the art to recolour, for character palettes
+	Swaps map[color.NRGBA]color.NRGBA
+	Hue   float64 // Degrees to turn the hue of colours that aren't swapped
+}
+
+type descriptor struct {
+	Base  string            `json:"base"`
+	Swaps map[string]string `json:"swaps"`
+	Hue   float64           `json:"hue"`
+}
+
+// Load reads a file of palettes
+func Load(data []byte) (map[string]*Palette, error) {
+	var ds map[string]descriptor
+	if err := json.Unmarshal(data, &ds); err != nil {
+		return nil, err
+	}
+	palettes := make(map[string]*Palette)
+	for name, d := range ds {
+		p := &Palette{Name: name, Base: d.Base, Hue: d.Hue, Swaps: make(map[color.NRGBA]color.NRGBA)}
+		for from, to := range d.Swaps {
+			f, err := ParseColor(from)
+			if err != nil {
+				return nil, fmt.Errorf("palette %s: %v", name, err)
+			}
+			t, err := ParseColor(to)
+			if err != nil {
+				return nil, fmt.Errorf("palette %s: %v", name, err)
+			}
+			p.Swaps[f] = t
+		}
+		palettes[name] = p
+	}
+	return palettes, nil
+}
+
+// ParseColor reads a colour written as #rrggbb, or #rrggbbaa with alpha
+func ParseColor(s string) (color.NRGBA, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 8 || !strings.HasPrefix(s, "#") || err != nil {
+		return color.NRGBA{}, fmt.Errorf("%q is not a colour like #rrggbb", s)
+	}
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
+
+// Color returns what the palette turns c into
+func (p *Palette) Color(c color.NRGBA) color.NRGBA {
+	if to, ok := p.Swaps[c]; ok {
+		return to
+	}
+	if p.Hue == 0 || c.A == 0 {
+		return c
+	}
+	return rotateHue(c, p.Hue)
+}
+
+// Apply returns a recoloured copy of src
+func (p *Palette) Apply(src image.Image) *image.NRGBA {
+	b := src.Bounds()
+	dst := image.NewNRGBA(b)
+	draw.Draw(dst, b, src, b.Min, draw.Src)
+	// Art only has a handful of colours, so work each one out once
+	seen := make(map[color.NRGBA]color.NRGBA)
+	for i := 0; i+3 < len(dst.Pix); i += 4 {
+		c := color.NRGBA{R: dst.Pix[i], G: dst.Pix[i+1], B: dst.Pix[i+2], A: dst.Pix[i+3]}
+		to, ok := seen[c]
+		if !ok {
+			to = p.Color(c)
+			seen[c] = to
+		}
+		dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] = to.R, to.G, to.B, to.A
+	}
+	return dst
+}
+
+// rotateHue turns the hue of c by deg degrees, keeping its brightness, the
+// same way as the CSS hue-rotate filter
+func rotateHue(c color.NRGBA, deg float64) color.NRGBA {
+	sin, cos := math.Sincos(deg * math.Pi / 180)
+	r, g, b := float64(c.R), float64(c.G), float64(c.B)
+	return color.NRGBA{
+		R: clamp((0.213+cos*0.787-sin*0.213)*r + (0.715-cos*0.715-sin*0.715)*g + (0.072-cos*0.072+sin*0.928)*b),
+		G: clamp((0.213-cos*0.213+sin*0.143)*r + (0.715+cos*0.285+sin*0.140)*g + (0.072-cos*0.072-sin*0.283)*b),
+		B: clamp((0.213-cos*0.213-sin*0.787)*r + (0.715-cos*0.715+sin*0.715)*g + (0.072+cos*0.928+sin*0.072)*b),
+		A: c.A,
+	}
+}
+
+func clamp(v float64) uint8 {
+	return uint8(math.Max(0, math.Min(255, math.Round(v))))
+}
@@ -0,0 +1,107 @@
+package palette
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		s    string
+		want color.NRGBA
+		ok   bool
+	}{
+		{"#285a32", color.NRGBA{0x28, 0x5a, 0x32, 0xff}, true},
+		{"#285A32", color.NRGBA{0x28, 0x5a, 0x32, 0xff}, true},
+		{"#285a3280", color.NRGBA{0x28, 0x5a, 0x32, 0x80}, true},
+		{"#00000000", color.NRGBA{}, true},
+		{"285a32", color.NRGBA{}, false},
+		{"#285a3", color.NRGBA{}, false},
+		{"#285a320", color.NRGBA{}, false},
+		{"#285a32ff00", color.NRGBA{}, false},
+		{"#28sa32", color.NRGBA{}, false},
+		{"#-85a32", color.NRGBA{}, false},
+		{"", color.NRGBA{}, false},
+	}
+	for _, tt := range tests {
+		c, err := ParseColor(tt.s)
+		if (err == nil) != tt.ok || c != tt.want {
+			t.Errorf("ParseColor(%q) = %v, %v; want %v, ok %v", tt.s, c, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	ps, err := Load([]byte(`{
+		"Green": {"base": "Black", "swaps": {"#090010": "#0a3c14", "#222222": "#285a3280"}},
+		"Dusk": {"hue": 300}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := ps["Green"]
+	if g.Name != "Green" || g.Base != "Black" || len(g.Swaps) != 2 || g.Swaps[color.NRGBA{0x22, 0x22, 0x22, 0xff}] != (color.NRGBA{0x28, 0x5a, 0x32, 0x80}) {
+		t.Errorf("Green is %+v", g)
+	}
+	if d := ps["Dusk"]; d.Hue != 300 || d.Base != "" || len(d.Swaps) != 0 {
+		t.Errorf("Dusk is %+v", d)
+	}
+
+	_, err = Load([]byte(`{"Green": {"swaps": {"#090010": "green"}}}`))
+	if err == nil || !strings.Contains(err.Error(), `palette Green: "green" is not a colour`) {
+		t.Errorf("got error %v for a bad colour", err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	p := &Palette{Swaps: map[color.NRGBA]color.NRGBA{{0x22, 0x22, 0x22, 0xff}: {0x28, 0x5a, 0x32, 0xff}}}
+	src := image.NewNRGBA(image.Rect(2, 3, 5, 4))
+	src.SetNRGBA(2, 3, color.NRGBA{0x22, 0x22, 0x22, 0xff})
+	src.SetNRGBA(3, 3, color.NRGBA{0x22, 0x22, 0x22, 0x80})
+	src.SetNRGBA(4, 3, color.NRGBA{0x22, 0x22, 0x22, 0xff})
+
+	dst := p.Apply(src)
+	if dst.Bounds() != src.Bounds() {
+		t.Fatalf("recoloured image at %v", dst.Bounds())
+	}
+	// Only exact matches are swapped, see through pixels included
+	want := []color.NRGBA{{0x28, 0x5a, 0x32, 0xff}, {0x22, 0x22, 0x22, 0x80}, {0x28, 0x5a, 0x32, 0xff}}
+	for i, w := range want {
+		if c := dst.NRGBAAt(2+i, 3); c != w {
+			t.Errorf("pixel %d is %v, want %v", i, c, w)
+		}
+	}
+	if c := src.NRGBAAt(2, 3); c != (color.NRGBA{0x22, 0x22, 0x22, 0xff}) {
+		t.Errorf("source changed to %v", c)
+	}
+}
+
+func TestHue(t *testing.T) {
+	red := color.NRGBA{0xff, 0, 0, 0xff}
+	tests := []struct {
+		hue  float64
+		in   color.NRGBA
+		want color.NRGBA
+	}{
+		{0, red, red},
+		{360, red, red},
+		{180, color.NRGBA{0x80, 0x80, 0x80, 0xff}, color.NRGBA{0x80, 0x80, 0x80, 0xff}}, // Greys have no hue
+		{120, color.NRGBA{}, color.NRGBA{}},                                             // Nor does nothing
+	}
+	for _, tt := range tests {
+		p := &Palette{Hue: tt.hue}
+		if c := p.Color(tt.in); c != tt.want {
+			t.Errorf("turning %v by %v gave %v, want %v", tt.in, tt.hue, c, tt.want)
+		}
+	}
+	// Swaps win over turning the hue
+	p := &Palette{Hue: 90, Swaps: map[color.NRGBA]color.NRGBA{red: {0, 0, 0xff, 0xff}}}
+	if c := p.Color(red); c != (color.NRGBA{0, 0, 0xff, 0xff}) {
+		t.Errorf("swapped red to %v", c)
+	}
+	if c := (&Palette{Hue: 120}).Color(red); c.G <= c.R || c.G <= c.B {
+		t.Errorf("red turned 120 degrees is %v, want mostly green", c)
+	}
+}
@@ -1,22 +1,22 @@
 package player
 
 import (
-	"fmt"
+	"ebi/anim"
+	"ebi/camera"
+	"ebi/gfx"
 	"image/color"
+	"math"
 
 	"github.com/hajimehoshi/ebiten/v2"
 )
 
 type Player struct {
-	FrameWidth        int
-	FrameHeight       int
-	FrameCount        int
-	CurrentFrame      int
-	TickCount         int // Counter to track the number of updates
-	X, Y              float64
-	SpriteSheets      map[string]*ebiten.Image // Map of sprite sheets for each direction
+	Anim              *anim.Animator
+	Skin              string  // Picks the sprite sheets and portraits, e.g. "Black"
+	X, Y              float64 // World position of the top left of the sprite
 	Direction         string
 	Speed             float64
+	Moving            bool // Whether the player walked this tick
 	CanMove           bool
 	GhostMode         bool
 	GhostModeMeter    float64 // Time remaining in ghost mode
@@ -28,65 +28,111 @@ type Player struct {
 	LastKeyPressTick  uint64 // Tick count of the last key press
 }
 
-func (p Player) CheckMove(dir string) (float64, float64) {
+// CheckMove returns where the player would end up walking one step in the
+// direction dx, dy (right and down are positive). Diagonal steps are scaled
+// down so they cover the same distance as straight ones.
+func (p Player) CheckMove(dx, dy float64) (float64, float64) {
 	if p.IsRunning {
 		p.Speed = p.Speed * 2
 	}
-	switch dir {
-	case "left":
-		p.X += p.Speed // Move left
-	case "right":
-		p.X -= p.Speed // Move right
-	case "up":
-		p.Y += p.Speed // Move up
-	case "down":
-		p.Y -= p.Speed // Move down
+	if l := math.Hypot(dx, dy); l > 0 {
+		dx, dy = dx/l, dy/l
 	}
+	p.X += dx * p.Speed
+	p.Y += dy * p.Speed
 	return p.X, p.Y
 
 }
 
+// PressKey tracks a held movement key; pressing a key again within
+// 15 ticks of the last press starts running.
+func (p *Player) PressKey(key ebiten.Key) {
+	p.DoubleTapKey = key
+	if !p.KeyBeingPressed {
+		// Key is pressed for the first time or after being released
+		p.KeyBeingPressed = true
+		if p.TickCounter-p.LastKeyPressTick <= 15 && p.TickCounter-p.LastKeyPressTick > 0 {
+			p.IsRunning = true
+		}
+		p.LastKeyPressTick = p.TickCounter
+	}
+}
+
+// Position, SetPosition, Face, Size and Walk let cutscenes move the player
+// around like an NPC
+
+func (p *Player) Position() (float64, float64) { return p.X, p.Y }
+func (p *Player) SetPosition(x, y float64)     { p.X, p.Y = x, y }
+func (p *Player) Face(dir string)              { p.Direction = dir }
+func (p *Player) Size() (int, int)             { return p.Anim.Size() }
+
+// Walk plays the walking animation while moving is true and the idle one
+// once the player stops
+func (p *Player) Walk(moving bool) {
+	p.Moving = moving
+	p.Animate()
+}
+
+// Animate picks the clip for what the player is doing, idle, walk or run, and
+// advances it a tick
+func (p *Player) Animate() {
+	clip := "idle"
+	if p.Moving && p.IsRunning {
+		clip = "run"
+	} else if p.Moving {
+		clip = "walk"
+	}
+	p.Anim.PlayDir(clip, p.Direction)
+	p.Anim.Update()
+}
+
+// SortY returns where the player's feet are, for drawing things lower down
+// the screen in front
+func (p *Player) SortY() float64 {
+	_, h := p.Size()
+	return p.Y + float64(h)
+}
+
+// Draw draws the player, see through while in ghost mode
+func (p *Player) Draw(screen *ebiten.Image, cam *camera.Camera) {
+	opts := &ebiten.DrawImageOptions{}
+	if p.GhostMode {
+		opts.ColorScale.Scale(1, 1, 1, 0.5)
+	}
+	p.Anim.Draw(screen, p.X, p.Y, cam, opts)
+}
+
 func (p *Player) DrawGhostModeMeter(screen *ebiten.Image) {
 	// Define meter dimensions and position
 	const meterWidth = 300 // Adjust as needed
 	const meterHeight = 20 // Adjust as needed
 	const meterX = 50      // Position of the meter on screen
 	const meterY = 50
+	const scale = 0.25 // The meter is drawn at a quarter of its size
 
 	// Calculate the width of the filled part based on the current meter value
 
 	var filledWidth float64
 	if p.GhostModeMeter > 0 {
-		fmt.Println(p.GhostModeMeter)
 		filledWidth = (p.GhostModeMeter / 600) * meterWidth
 	} else {
-		fmt.Println("reached")
 		filledWidth = ((600 - p.GhostModeCooldown) / 600) * meterWidth
 	}
 	if filledWidth < 1 {
-		fmt.Println("Wow")
 		filledWidth = 1
 	}
-	// Create a background bar (empty meter)
-	emptyBar := ebiten.NewImage(meterWidth, meterHeight)
-	emptyBar.Fill(color.RGBA{R: 0, G: 0, B: 0, A: 255}) // Grey color
 
-	// Create a filled bar (current meter value)
-	filledBar := ebiten.NewImage(int(filledWidth), meterHeight)
+	// Draw the empty bar
+	gfx.FillRect(screen, meterX*scale, meterY*scale, meterWidth*scale, meterHeight*scale, color.RGBA{R: 0, G: 0, B: 0, A: 255})
+
+	// Draw the filled bar on top of the empty bar
+	var clr color.RGBA
 	if filledWidth > 150 {
-		filledBar.Fill(color.RGBA{R: 0, G: 255, B: 0, A: 255}) // Green color
+		clr = color.RGBA{R: 0, G: 255, B: 0, A: 255} // Green color
 	} else if filledWidth > 75 {
-		filledBar.Fill(color.RGBA{R: 255, G: 255, B: 0, A: 255}) // Yellow Color
+		clr = color.RGBA{R: 255, G: 255, B: 0, A: 255} // Yellow Color
 	} else {
-		filledBar.Fill(color.RGBA{R: 255, G: 0, B: 0, A: 255}) // Red Color
+		clr = color.RGBA{R: 255, G: 0, B: 0, A: 255} // Red Color
 	}
-
-	// Draw the empty bar
-	opts := &ebiten.DrawImageOptions{}
-	opts.GeoM.Translate(meterX, meterY)
-	opts.GeoM.Scale(0.25, 0.25)
-	screen.DrawImage(emptyBar, opts)
-
-	// Draw the filled bar on top of the empty bar
-	screen.DrawImage(filledBar, opts)
+	gfx.FillRect(screen, meterX*scale, meterY*scale, math.Floor(filledWidth)*scale, meterHeight*scale, clr)
 }
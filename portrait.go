@@ -0,0 +1,117 @@
+package main
+
+import (
+	"ebi/anim"
+	"ebi/palette"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+// Skin the player starts with
+const playerSkin = "Black"
+
+// Portraits live alongside the sprite sheets: a character whose sheets are
+// assets/player<Dir><Skin>.png has its portrait in assets/portrait<Skin>.png
+// and one per expression in assets/portrait<Skin><Expression>.png, like
+// portraitBlueHappy.png. A character without a portrait talks without one.
+// Palette skins without portraits of their own use their base skin's,
+// recoloured.
+func portraitPath(skin, expression string) string {
+	c := cases.Title(language.English)
+	return anim.SkinPath("assets/portrait{skin}"+c.String(expression)+".png", skin)
+}
+
+// speaker is someone who can talk in a dialogue
+type speaker struct {
+	Name string // For the name plate, may be a string ID
+	Skin string
+}
+
+// loadSpeakers collects the player and the NPCs from the scene files, so
+// dialogue lines can name who says them
+func (g *Game) loadSpeakers() {
+	g.speakers = map[string]speaker{"player": {Name: "@player.name", Skin: g.player.Skin}}
+	names := make([]string, 0, len(g.Scenes))
+	for name := range g.Scenes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, n := range g.Scenes[name].def.NPCs {
+			if _, ok := g.speakers[n.Name]; ok {
+				continue
+			}
+			display := n.DisplayName
+			if display == "" {
+				display = n.Name
+			}
+			g.speakers[n.Name] = speaker{Name: display, Skin: n.Skin}
+		}
+	}
+}
+
+// portrait returns a speaker's portrait with an expression, or nil if they
+// don't have one
+func (g *Game) portrait(name, expression string) *ebiten.Image {
+	sp, ok := g.speakers[name]
+	if !ok {
+		return nil
+	}
+	path, pal, ok := g.findPortrait(sp.Skin, expression)
+	if !ok {
+		return nil
+	}
+	img, err := g.assets.Recolored(path, pal)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	return img
+}
+
+// findPortrait returns the file with a skin's portrait and the palette to
+// recolour it with, if any
+func (g *Game) findPortrait(skin, expression string) (string, *palette.Palette, bool) {
+	if path := portraitPath(skin, expression); g.assets.Exists(path) {
+		return path, nil, true
+	}
+	if pal, ok := g.palettes[skin]; ok {
+		if path := portraitPath(pal.Base, expression); g.assets.Exists(path) {
+			return path, pal, true
+		}
+	}
+	return "", nil, false
+}
+
+// checkSpeakers makes sure every line in the dialogue files is said by
+// someone the game knows, with an expression they have a portrait for
+func (g *Game) checkSpeakers(db DialogueDB) error {
+	for _, convs := range db {
+		for _, c := range convs {
+			for id, n := range c.Nodes {
+				for i := range n.Text {
+					l := n.line(i)
+					if l.Speaker == "" {
+						continue
+					}
+					sp, ok := g.speakers[l.Speaker]
+					if !ok {
+						return fmt.Errorf("dialogue %s, node %s: unknown speaker %q", c.Name, id, l.Speaker)
+					}
+					if l.Expression == "" {
+						continue
+					}
+					if _, _, ok := g.findPortrait(sp.Skin, l.Expression); !ok {
+						return fmt.Errorf("dialogue %s, node %s: %s has no %q portrait, %s is missing", c.Name, id, l.Speaker, l.Expression, portraitPath(sp.Skin, l.Expression))
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPortraitPath(t *testing.T) {
+	tests := []struct{ skin, expression, want string }{
+		{"Blue", "", "assets/portraitBlue.png"},
+		{"Blue", "happy", "assets/portraitBlueHappy.png"},
+		{"default", "angry", "assets/portraitAngry.png"},
+	}
+	for _, tt := range tests {
+		if got := portraitPath(tt.skin, tt.expression); got != tt.want {
+			t.Errorf("portraitPath(%q, %q) = %q, want %q", tt.skin, tt.expression, got, tt.want)
+		}
+	}
+}
+
+// Palette skins without portraits of their own borrow their base skin's
+func TestFindPortrait(t *testing.T) {
+	g := newTestGame(t)
+	var err error
+	if g.palettes, err = loadPalettes(g.assets); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		skin, expression string
+		path, palette    string // Empty path for no portrait
+	}{
+		{"Black", "", "assets/portraitBlack.png", ""},
+		{"Blue", "happy", "assets/portraitBlueHappy.png", ""},
+		{"Green", "", "assets/portraitBlack.png", "Green"},
+		{"Black", "happy", "", ""},
+		{"Purple", "", "", ""},
+	}
+	for _, tt := range tests {
+		path, pal, ok := g.findPortrait(tt.skin, tt.expression)
+		name := ""
+		if pal != nil {
+			name = pal.Name
+		}
+		if ok != (tt.path != "") || path != tt.path || name != tt.palette {
+			t.Errorf("findPortrait(%q, %q) = %q, palette %q, %v; want %q, palette %q", tt.skin, tt.expression, path, name, ok, tt.path, tt.palette)
+		}
+	}
+}
+
+func TestCheckSpeakers(t *testing.T) {
+	g := newTestGame(t)
+	g.speakers = map[string]speaker{"player": {Name: "@player.name", Skin: "Black"}, "Bryan": {Name: "Bryan", Skin: "Blue"}}
+	if err := g.checkSpeakers(g.dialogues); err != nil {
+		t.Errorf("the game's dialogue: %v", err)
+	}
+
+	tests := []struct {
+		node DialogueNode
+		err  string
+	}{
+		{DialogueNode{Speaker: "Alice", Text: []DialogueLine{{Text: "Hi"}}}, `unknown speaker "Alice"`},
+		{DialogueNode{Speaker: "Bryan", Text: []DialogueLine{{Text: "Hi", Expression: "sleepy"}}}, `Bryan has no "sleepy" portrait, assets/portraitBlueSleepy.png is missing`},
+		{DialogueNode{Speaker: "Bryan", Expression: "happy", Text: []DialogueLine{{Text: "Hi", Speaker: "player"}}}, ""},
+	}
+	for _, tt := range tests {
+		db := DialogueDB{"Bryan": {{ID: "test", DialogueTree: DialogueTree{Name: "Bryan/test", Nodes: map[string]*DialogueNode{"start": &tt.node}}}}}
+		err := g.checkSpeakers(db)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%+v: %v", tt.node, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%+v: got error %v, want %q", tt.node, err, tt.err)
+		}
+	}
+}
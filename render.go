@@ -0,0 +1,193 @@
+package main
+
+import (
+	"ebi/camera"
+	"ebi/gfx"
+	"fmt"
+	"image"
+	"image/color"
+	"sort"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text"
+)
+
+// A frame is drawn in layers, bottom to top:
+//   - the scene's background
+//   - the entities, NPCs, the player and props, lower down the screen in front
+//   - the scene's foreground, which characters walk behind
+//   - UI, like dialogue and meters
+//   - overlays over the whole screen, like fades
+//
+// Each game state says which of them it shows and how, so a new state only
+// needs an entry in stateRenders.
+
+// drawFunc draws part of the UI or an overlay
+type drawFunc func(g *Game, screen *ebiten.Image)
+
+// stateRender says how a game state draws
+type stateRender struct {
+	world   bool              // Draw the scene and everyone in it
+	tint    ebiten.ColorScale // Applied to the background and foreground
+	ui      []drawFunc
+	overlay []drawFunc
+}
+
+var stateRenders = map[GameState]stateRender{
+	MenuState:       {ui: []drawFunc{drawMenu}},
+	PlayState:       {world: true, ui: []drawFunc{drawDialogue, drawGhostModeMeter}},
+	TransitionState: {world: true, overlay: []drawFunc{drawFade}},
+	NewSceneState:   {world: true, overlay: []drawFunc{drawFade}},
+	CutsceneState:   {world: true, ui: []drawFunc{drawDialogue}, overlay: []drawFunc{drawFade}},
+	TimeStopped:     {world: true, tint: dim(0.5)}, // Everyone stands out against the frozen world
+}
+
+func (g *Game) Draw(screen *ebiten.Image) {
+	r := stateRenders[g.state]
+	if r.world {
+		g.drawScenery(screen, g.Scenes[g.CurrentScene].Background, r.tint)
+		g.drawEntities(screen, r.tint)
+		g.drawScenery(screen, g.Scenes[g.CurrentScene].Foreground, r.tint)
+	}
+	for _, draw := range r.ui {
+		draw(g, screen)
+	}
+	for _, draw := range r.overlay {
+		draw(g, screen)
+	}
+}
+
+// dim returns a tint darkening colours to the given brightness
+func dim(brightness float32) ebiten.ColorScale {
+	var c ebiten.ColorScale
+	c.Scale(brightness, brightness, brightness, 1)
+	return c
+}
+
+// drawScenery draws a background or foreground image of the scene
+func (g *Game) drawScenery(screen, img *ebiten.Image, tint ebiten.ColorScale) {
+	opts := &ebiten.DrawImageOptions{ColorScale: tint}
+	g.camera.Apply(&opts.GeoM)
+	screen.DrawImage(img, opts)
+}
+
+// entity is something in the scene drawn in order of where it meets the ground
+type entity interface {
+	SortY() float64
+	Draw(screen *ebiten.Image, cam *camera.Camera)
+}
+
+// drawEntities draws the NPCs, the player and the props from the top of the
+// screen down, so whoever stands lower is in front. Props are part of the
+// scenery, so they are tinted like it.
+func (g *Game) drawEntities(screen *ebiten.Image, tint ebiten.ColorScale) {
+	s := g.Scenes[g.CurrentScene]
+	g.entities = g.entities[:0]
+	for _, p := range s.props {
+		p.tint = tint
+		g.entities = append(g.entities, p)
+	}
+	for _, cnpc := range s.NPCs {
+		g.entities = append(g.entities, cnpc)
+	}
+	g.entities = append(g.entities, g.player)
+	// Stable, so on a tie characters stay in front of props
+	sort.Stable(&g.entities)
+	for _, e := range g.entities {
+		e.Draw(screen, g.camera)
+	}
+}
+
+// byDepth sorts entities top of the screen first. Sort a pointer to it: that
+// fits in sort.Interface as it is, where the slice would be copied to the heap
+// every frame.
+type byDepth []entity
+
+func (d byDepth) Len() int           { return len(d) }
+func (d byDepth) Less(i, j int) bool { return d[i].SortY() < d[j].SortY() }
+func (d byDepth) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+
+// prop is a part of the foreground drawn as an entity
+type prop struct {
+	image *ebiten.Image
+	x, y  float64
+	sortY float64
+	tint  ebiten.ColorScale
+}
+
+func (p *prop) SortY() float64 { return p.sortY }
+
+func (p *prop) Draw(screen *ebiten.Image, cam *camera.Camera) {
+	opts := &ebiten.DrawImageOptions{ColorScale: p.tint}
+	opts.GeoM.Translate(p.x, p.y)
+	cam.Apply(&opts.GeoM)
+	screen.DrawImage(p.image, opts)
+}
+
+// cutProps cuts the props out of a foreground. It returns a copy of the
+// foreground without them, leaving fg as it is since it may be shared.
+func cutProps(fg *ebiten.Image, defs []PropDef) (*ebiten.Image, []*prop) {
+	if len(defs) == 0 {
+		return fg, nil
+	}
+	rest := ebiten.NewImage(fg.Bounds().Dx(), fg.Bounds().Dy())
+	rest.DrawImage(fg, nil)
+	props := make([]*prop, 0, len(defs))
+	for _, d := range defs {
+		r := image.Rect(d.X1, d.Y1, d.X2, d.Y2).Intersect(fg.Bounds())
+		if r.Empty() {
+			continue
+		}
+		sortY := d.SortY
+		if sortY == 0 {
+			sortY = r.Max.Y
+		}
+		props = append(props, &prop{
+			image: fg.SubImage(r).(*ebiten.Image),
+			x:     float64(r.Min.X),
+			y:     float64(r.Min.Y),
+			sortY: float64(sortY),
+		})
+		rest.SubImage(r).(*ebiten.Image).Clear()
+	}
+	return rest, props
+}
+
+func drawMenu(g *Game, screen *ebiten.Image) {
+	x := 4
+	y := 20
+	spacing := 20
+	for i, option := range g.menuOptions {
+		// Change color or style if option is selected
+		col := color.White
+		if i == g.selectedOption {
+			col = color.Black // Highlighted color
+		}
+		text.Draw(screen, g.menuLabel(option), g.fface, x, y+i*spacing, col)
+	}
+}
+
+// menuLabel returns the text of a menu option in the current language
+func (g *Game) menuLabel(option string) string {
+	label := g.locale.T(option)
+	if option == "menu.language" {
+		label = fmt.Sprintf(label, g.locale.T("language.name"))
+	}
+	return label
+}
+
+func drawDialogue(g *Game, screen *ebiten.Image) {
+	g.dialogue.Draw(screen, g)
+}
+
+// drawGhostModeMeter shows the meter while ghost mode is on or recharging
+func drawGhostModeMeter(g *Game, screen *ebiten.Image) {
+	if g.player.GhostMode || g.player.GhostModeCooldown > 0 {
+		g.player.DrawGhostModeMeter(screen)
+	}
+}
+
+// drawFade darkens the screen by g.alpha, for fading between scenes
+func drawFade(g *Game, screen *ebiten.Image) {
+	gfx.Fill(screen, color.RGBA{0, 0, 0, uint8(g.alpha * 0xff)}) // Black with variable alpha
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"sort"
+	"testing"
+)
+
+// Lower down is in front, and on a tie the earlier entity stays behind
+func TestByDepth(t *testing.T) {
+	a, b, c, d := &prop{sortY: 30}, &prop{sortY: 10}, &prop{sortY: 30}, &prop{sortY: 20}
+	es := byDepth{a, b, c, d}
+	sort.Stable(&es)
+	want := byDepth{b, d, a, c}
+	for i := range want {
+		if es[i] != want[i] {
+			t.Fatalf("entity %d has sortY %v, want %v", i, es[i].SortY(), want[i].SortY())
+		}
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		es[0], es[3] = es[3], es[0]
+		sort.Stable(&es)
+	})
+	if allocs != 0 {
+		t.Errorf("sorting allocates %v times", allocs)
+	}
+}
@@ -0,0 +1,81 @@
+package richtext
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const zwj = '\u200d'
+
+// nextChar returns the first character of s as the player sees it: a rune
+// together with any combining marks, variation selectors, skin tone modifiers
+// and zero width joined runes that follow it. This is a cut down version of
+// grapheme clusters, enough that the typewriter never shows half a letter.
+func nextChar(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	prev := r
+	for n < len(s) {
+		next, size := utf8.DecodeRuneInString(s[n:])
+		switch {
+		case extends(next), prev == zwj:
+		case isRegional(prev) && isRegional(next) && countRegional(s[:n])%2 == 1:
+			// Flags are made of two regional indicators
+		default:
+			return s[:n]
+		}
+		prev = next
+		n += size
+	}
+	return s[:n]
+}
+
+// extends reports whether r is drawn on top of, or joined to, the rune
+// before it
+func extends(r rune) bool {
+	return unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc) ||
+		r == zwj ||
+		(r >= 0xfe00 && r <= 0xfe0f) || // Variation selectors
+		(r >= 0x1f3fb && r <= 0x1f3ff) // Skin tones
+}
+
+func isRegional(r rune) bool {
+	return r >= 0x1f1e6 && r <= 0x1f1ff
+}
+
+func countRegional(s string) int {
+	n := 0
+	for _, r := range s {
+		if isRegional(r) {
+			n++
+		}
+	}
+	return n
+}
+
+// Japanese and Chinese don't put spaces between words, so lines can break
+// between any two of their characters, except that some punctuation can't
+// start a line and opening brackets can't end one.
+const (
+	noBreakBefore = "、。，．・：；？！ー…‥」』）〕］｝〉》】〙〗〟’”ヽヾゝゞ々" +
+		"ぁぃぅぇぉっゃゅょゎゕゖァィゥェォッャュョヮヵヶ" +
+		".,!?;:)]}%"
+	noBreakAfter = "「『（〔［｛〈《【〘〖〝‘“([{"
+)
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) ||
+		(r >= 0x3000 && r <= 0x303f) || // CJK punctuation
+		(r >= 0xff00 && r <= 0xffef) // Full width forms
+}
+
+// canBreak reports whether a line can break between two characters that
+// aren't separated by a space
+func canBreak(before, after string) bool {
+	b, _ := utf8.DecodeRuneInString(before)
+	a, _ := utf8.DecodeRuneInString(after)
+	if !isCJK(b) && !isCJK(a) {
+		return false
+	}
+	return !strings.ContainsRune(noBreakBefore, a) && !strings.ContainsRune(noBreakAfter, b)
+}
@@ -0,0 +1,43 @@
+package richtext
+
+import "testing"
+
+func TestNextChar(t *testing.T) {
+	tests := []struct{ s, want string }{
+		{"abc", "a"},
+		{"", ""},
+		{"e\u0301x", "e\u0301"}, // Combining accent
+		{"❤️x", "❤️"},           // Variation selector
+		{"👍🏽👍", "👍🏽"},           // Skin tone
+		{"👩‍👩‍👧!", "👩‍👩‍👧"}, // Joined family
+		{"🇯🇵🇫🇷", "🇯🇵"},      // Flags pair up regional indicators
+		{"日本", "日"},
+	}
+	for _, tt := range tests {
+		if got := nextChar(tt.s); got != tt.want {
+			t.Errorf("nextChar(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestCanBreak(t *testing.T) {
+	tests := []struct {
+		before, after string
+		want          bool
+	}{
+		{"a", "b", false},
+		{"日", "本", true},
+		{"a", "日", true},
+		{"日", "a", true},
+		{"う", "。", false}, // Full stops don't start a line
+		{"う", "ッ", false}, // Nor do small kana
+		{"「", "う", false}, // Opening brackets don't end one
+		{"」", "う", true},
+		{"日", ".", false},
+	}
+	for _, tt := range tests {
+		if got := canBreak(tt.before, tt.after); got != tt.want {
+			t.Errorf("canBreak(%q, %q) = %v, want %v", tt.before, tt.after, got, tt.want)
+		}
+	}
+}
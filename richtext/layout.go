@@ -0,0 +1,115 @@
+package richtext
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// Placed is a glyph with its place in the wrapped text
+type Placed struct {
+	Glyph
+	X    fixed.Int26_6 // From the left edge of the text
+	Line int           // Line on its page
+	Page int
+}
+
+// Layout wraps glyphs into lines no wider than maxWidth and splits the lines
+// into pages of maxLines, or a single page if maxLines is 0. Lines break at
+// spaces, newlines and between CJK characters, and a word too long for a
+// line of its own is broken wherever it runs out of room. Every glyph gets a
+// place, so the result can be indexed the same way as glyphs.
+func Layout(glyphs []Glyph, face font.Face, maxWidth, maxLines int) []Placed {
+	placed := make([]Placed, len(glyphs))
+	max := fixed.I(maxWidth)
+	advance := func(i int) fixed.Int26_6 {
+		return font.MeasureString(face, glyphs[i].Text)
+	}
+	var x fixed.Int26_6
+	line, page := 0, 0
+	newLine := func() {
+		x = 0
+		line++
+		if maxLines > 0 && line >= maxLines {
+			line = 0
+			page++
+		}
+	}
+	place := func(i int) {
+		placed[i] = Placed{glyphs[i], x, line, page}
+		x += advance(i)
+	}
+	for i := 0; i < len(glyphs); {
+		switch glyphs[i].Text {
+		case "\n":
+			placed[i] = Placed{glyphs[i], x, line, page}
+			newLine()
+			i++
+			continue
+		case " ":
+			place(i)
+			i++
+			continue
+		}
+
+		// Measure up to where the line could next break
+		j := i + 1
+		w := advance(i)
+		for ; j < len(glyphs) && !isSpace(glyphs[j]) && !canBreak(glyphs[j-1].Text, glyphs[j].Text); j++ {
+			w += advance(j)
+		}
+		if x > 0 && x+w > max {
+			newLine()
+		}
+		for ; i < j; i++ {
+			if x > 0 && x+advance(i) > max {
+				newLine()
+			}
+			place(i)
+		}
+	}
+	return placed
+}
+
+// PageEnd returns the index just past the last glyph on the same page as
+// placed[start]
+func PageEnd(placed []Placed, start int) int {
+	end := start
+	for end < len(placed) && placed[end].Page == placed[start].Page {
+		end++
+	}
+	return end
+}
+
+func isSpace(g Glyph) bool {
+	return g.Text == " " || g.Text == "\n"
+}
+
+// Draw draws placed glyphs with the top line's baseline at x, y. Pass it a
+// single page at a time. frame drives the shake and wave effects.
+func Draw(dst *ebiten.Image, placed []Placed, face font.Face, x, y int, clr color.Color, frame int) {
+	lineHeight := face.Metrics().Height.Ceil()
+	for i, p := range placed {
+		if isSpace(p.Glyph) {
+			continue
+		}
+		c := clr
+		if p.Color != nil {
+			c = p.Color
+		}
+		dx, dy := 0, 0
+		switch p.Effect {
+		case Shake:
+			// Cheap hash so every glyph jitters on its own, changing every other frame
+			h := uint32(frame/2)*2654435761 ^ uint32(i)*40503
+			dx, dy = int(h%3)-1, int(h/3%3)-1
+		case Wave:
+			dy = int(math.Round(2 * math.Sin(float64(frame)/6+float64(i)*0.6)))
+		}
+		text.Draw(dst, p.Text, face, x+p.X.Round()+dx, y+p.Line*lineHeight+dy, c)
+	}
+}
@@ -0,0 +1,132 @@
+package richtext
+
+import (
+	"image"
+	"strings"
+	"testing"
+	"unicode"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// monoFace is a face without glyph images where every character is 6 pixels
+// wide, or 12 for CJK ones, so line widths are easy to work out
+type monoFace struct{}
+
+func (monoFace) Close() error { return nil }
+
+func (f monoFace) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+	adv, _ := f.GlyphAdvance(r)
+	return image.Rectangle{}, nil, image.Point{}, adv, true
+}
+
+func (f monoFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	adv, _ := f.GlyphAdvance(r)
+	return fixed.R(0, -10, adv.Round(), 2), adv, true
+}
+
+func (monoFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	switch {
+	case extends(r):
+		return 0, true
+	case isCJK(r):
+		return fixed.I(12), true
+	}
+	return fixed.I(6), true
+}
+
+func (monoFace) Kern(r0, r1 rune) fixed.Int26_6 { return 0 }
+
+func (monoFace) Metrics() font.Metrics {
+	return font.Metrics{Height: fixed.I(12), Ascent: fixed.I(10), Descent: fixed.I(2)}
+}
+
+// lines lays out s and returns the text of each line, pages one after the
+// other
+func lines(t *testing.T, s string, maxWidth, maxLines int) []string {
+	t.Helper()
+	glyphs, err := Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	placed := Layout(glyphs, monoFace{}, maxWidth, maxLines)
+	var out []string
+	for i, p := range placed {
+		if i == 0 || p.Line != placed[i-1].Line || p.Page != placed[i-1].Page {
+			out = append(out, "")
+		}
+		if p.X+font.MeasureString(monoFace{}, p.Text) > fixed.I(maxWidth) && p.Text != " " && p.Text != "\n" {
+			t.Errorf("%q at %v runs past %d", p.Text, p.X, maxWidth)
+		}
+		out[len(out)-1] += p.Text
+	}
+	return out
+}
+
+func TestLayout(t *testing.T) {
+	tests := []struct {
+		name     string
+		s        string
+		maxWidth int
+		want     []string
+	}{
+		{"fits", "one two", 60, []string{"one two"}},
+		{"wraps at spaces", "aaa bbb ccc", 42, []string{"aaa bbb ", "ccc"}},
+		{"newline", "a\nb", 60, []string{"a\n", "b"}},
+		{"long word", "abcdefghijkl", 30, []string{"abcde", "fghij", "kl"}},
+		{"long word after short", "ab cdefghijkl", 30, []string{"ab ", "cdefg", "hijkl"}},
+		{"tags take no room", "[color=red]abc[/color] [wave]def[/wave]", 42, []string{"abc def"}},
+
+		// CJK characters are 12 wide, so three fit
+		{"cjk", "日本語のテキスト", 36, []string{"日本語", "のテキ", "スト"}},
+		{"cjk no break before", "あいう。えお", 36, []string{"あい", "う。え", "お"}},
+		{"cjk no break after", "あい「う」", 36, []string{"あい", "「う」"}},
+		{"cjk and latin", "abc日本", 36, []string{"abc日", "本"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := lines(t, tt.s, tt.maxWidth, 0)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// Breaking an overflowing word never splits a character made of several runes
+func TestLayoutKeepsCharacters(t *testing.T) {
+	const e = "e\u0301" // e and a combining acute accent
+	s := strings.Repeat(e, 7) + "🇯🇵🇯🇵"
+	got := lines(t, s, 18, 0)
+	want := []string{e + e + e, e + e + e, e + "🇯🇵", "🇯🇵"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	for _, line := range got {
+		if r := []rune(line)[0]; unicode.Is(unicode.Mn, r) {
+			t.Errorf("line %q starts with a combining mark", line)
+		}
+	}
+}
+
+func TestLayoutPages(t *testing.T) {
+	glyphs, err := Parse("aa bb cc dd ee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	placed := Layout(glyphs, monoFace{}, 12, 2)
+	// One word a line and two lines a page
+	want := []struct{ line, page int }{{0, 0}, {1, 0}, {0, 1}, {1, 1}, {0, 2}}
+	for i, p := range placed {
+		w := want[i/3]
+		if p.Line != w.line || p.Page != w.page {
+			t.Errorf("glyph %d %q on line %d page %d, want line %d page %d", i, p.Text, p.Line, p.Page, w.line, w.page)
+		}
+	}
+	for start, end := range map[int]int{0: 6, 4: 6, 6: 12, 12: 14} {
+		if got := PageEnd(placed, start); got != end {
+			t.Errorf("PageEnd(%d) = %d, want %d", start, got, end)
+		}
+	}
+}
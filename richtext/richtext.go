@@ -0,0 +1,189 @@
+// Package richtext reads the markup used in dialogue lines and draws it with
+// a typewriter effect. Tags are written in square brackets:
+//
+//	[color=red]...[/color]     colour a span, by name or as #rrggbb
+//	[speed=4]...[/speed]       frames per character inside the span
+//	[pause=30]                 wait 30 frames before the next character
+//	[shake]...[/shake]         jittering text
+//	[wave]...[/wave]           text bobbing up and down
+//	[[                         a literal [
+//
+// Spans can be nested and must be closed in the reverse order they were
+// opened. Tags are removed before the text is wrapped, so they never take
+// up space or show up half typed.
+package richtext
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+type Effect int
+
+const (
+	NoEffect Effect = iota
+	Shake
+	Wave
+)
+
+// Glyph is one character of parsed text with the style it is drawn in
+type Glyph struct {
+	Text          string
+	Color         color.Color // nil for the default colour
+	Effect        Effect
+	FramesPerChar int // 0 for the default typing speed
+	Pause         int // Frames to wait before this glyph appears
+}
+
+var colors = map[string]color.Color{
+	"white":  color.White,
+	"black":  color.Black,
+	"red":    color.RGBA{0xff, 0x50, 0x50, 0xff},
+	"green":  color.RGBA{0x60, 0xe0, 0x60, 0xff},
+	"blue":   color.RGBA{0x60, 0x90, 0xff, 0xff},
+	"yellow": color.RGBA{0xff, 0xd7, 0x00, 0xff},
+	"orange": color.RGBA{0xff, 0x99, 0x33, 0xff},
+	"purple": color.RGBA{0xc0, 0x70, 0xff, 0xff},
+	"gray":   color.RGBA{0xa0, 0xa0, 0xa0, 0xff},
+}
+
+type span struct {
+	tag   string
+	color color.Color
+	fx    Effect
+	speed int
+}
+
+// Parse turns marked up text into glyphs
+func Parse(s string) ([]Glyph, error) {
+	var (
+		glyphs []Glyph
+		stack  []span
+		pause  int
+	)
+	// The current style is whatever the innermost span says
+	style := func() Glyph {
+		var g Glyph
+		for _, sp := range stack {
+			if sp.color != nil {
+				g.Color = sp.color
+			}
+			if sp.fx != NoEffect {
+				g.Effect = sp.fx
+			}
+			if sp.speed != 0 {
+				g.FramesPerChar = sp.speed
+			}
+		}
+		return g
+	}
+
+	for i := 0; i < len(s); {
+		if strings.HasPrefix(s[i:], "[[") {
+			g := style()
+			g.Text, g.Pause = "[", pause
+			glyphs = append(glyphs, g)
+			pause = 0
+			i += 2
+			continue
+		}
+		if s[i] != '[' {
+			r := nextChar(s[i:])
+			g := style()
+			g.Text, g.Pause = r, pause
+			glyphs = append(glyphs, g)
+			pause = 0
+			i += len(r)
+			continue
+		}
+
+		end := strings.IndexByte(s[i:], ']')
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed tag at %q", s[i:])
+		}
+		tag := s[i+1 : i+end]
+		i += end + 1
+		name, value, hasValue := strings.Cut(tag, "=")
+
+		if strings.HasPrefix(name, "/") {
+			name = name[1:]
+			if len(stack) == 0 || stack[len(stack)-1].tag != name {
+				return nil, fmt.Errorf("[/%s] doesn't close the last opened tag", name)
+			}
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		sp := span{tag: name}
+		switch name {
+		case "color":
+			c, err := parseColor(value)
+			if err != nil {
+				return nil, err
+			}
+			sp.color = c
+		case "speed":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("[speed] needs a positive number of frames, got %q", value)
+			}
+			sp.speed = n
+		case "pause":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("[pause] needs a number of frames, got %q", value)
+			}
+			pause += n
+			continue
+		case "shake":
+			sp.fx = Shake
+		case "wave":
+			sp.fx = Wave
+		default:
+			return nil, fmt.Errorf("unknown tag [%s]", tag)
+		}
+		if hasValue != (name == "color" || name == "speed") {
+			return nil, fmt.Errorf("bad tag [%s]", tag)
+		}
+		stack = append(stack, sp)
+	}
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("[%s] is never closed", stack[len(stack)-1].tag)
+	}
+	return glyphs, nil
+}
+
+// Literal returns s as glyphs without looking for tags, for text that failed
+// to parse
+func Literal(s string) []Glyph {
+	var glyphs []Glyph
+	for i := 0; i < len(s); {
+		r := nextChar(s[i:])
+		glyphs = append(glyphs, Glyph{Text: r})
+		i += len(r)
+	}
+	return glyphs
+}
+
+// Plain returns the text of the glyphs with the markup gone
+func Plain(glyphs []Glyph) string {
+	var b strings.Builder
+	for _, g := range glyphs {
+		b.WriteString(g.Text)
+	}
+	return b.String()
+}
+
+func parseColor(s string) (color.Color, error) {
+	if c, ok := colors[s]; ok {
+		return c, nil
+	}
+	if len(s) == 7 && s[0] == '#' {
+		if v, err := strconv.ParseUint(s[1:], 16, 32); err == nil {
+			return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 0xff}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown colour %q", s)
+}
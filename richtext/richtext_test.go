@@ -0,0 +1,115 @@
+package richtext
+
+import (
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	red := colors["red"]
+	blue := colors["blue"]
+	glyphs, err := Parse("a[color=red]b[color=#6090ff]c[/color]d[/color][pause=30]e[[")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Glyph{
+		{Text: "a"},
+		{Text: "b", Color: red},
+		{Text: "c", Color: color.RGBA{0x60, 0x90, 0xff, 0xff}},
+		{Text: "d", Color: red},
+		{Text: "e", Pause: 30},
+		{Text: "["},
+	}
+	if len(glyphs) != len(want) {
+		t.Fatalf("got %d glyphs, want %d", len(glyphs), len(want))
+	}
+	for i, g := range glyphs {
+		if g != want[i] {
+			t.Errorf("glyph %d is %+v, want %+v", i, g, want[i])
+		}
+	}
+	if glyphs[2].Color != blue {
+		t.Errorf("#6090ff isn't the same colour as blue")
+	}
+}
+
+// The innermost span wins for whatever it sets, the others carry on through it
+func TestParseNested(t *testing.T) {
+	glyphs, err := Parse("[shake][speed=4][color=green]x[/color]y[/speed]z[/shake]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Glyph{
+		{Text: "x", Color: colors["green"], Effect: Shake, FramesPerChar: 4},
+		{Text: "y", Effect: Shake, FramesPerChar: 4},
+		{Text: "z", Effect: Shake},
+	}
+	for i, g := range glyphs {
+		if g != want[i] {
+			t.Errorf("glyph %d is %+v, want %+v", i, g, want[i])
+		}
+	}
+}
+
+// Pauses add up and go on the next glyph, wherever it is
+func TestParsePause(t *testing.T) {
+	glyphs, err := Parse("[pause=30]a [pause=10][pause=5][wave]b[/wave]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pauses := []int{30, 0, 15}
+	for i, g := range glyphs {
+		if g.Pause != pauses[i] {
+			t.Errorf("glyph %q pauses %d, want %d", g.Text, g.Pause, pauses[i])
+		}
+	}
+	if glyphs[2].Effect != Wave {
+		t.Errorf("b has effect %v, want Wave", glyphs[2].Effect)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		s, err string
+	}{
+		{"[color=red]never closed", "[color] is never closed"},
+		{"[wave][shake]x[/wave][/shake]", "[/wave] doesn't close the last opened tag"},
+		{"stray [/color]", "[/color] doesn't close the last opened tag"},
+		{"[color=red", "unclosed tag"},
+		{"[color=mauve]x[/color]", `unknown colour "mauve"`},
+		{"[color=#12345]x[/color]", `unknown colour "#12345"`},
+		{"[pause]", `[pause] needs a number of frames, got ""`},
+		{"[pause=-1]", "[pause] needs a number of frames"},
+		{"[speed=0]x[/speed]", "[speed] needs a positive number of frames"},
+		{"[wave=2]x[/wave]", "bad tag [wave=2]"},
+		{"[bold]x[/bold]", "unknown tag [bold]"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.s)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Parse(%q) gave error %v, want %q", tt.s, err, tt.err)
+		}
+	}
+}
+
+// Characters made of several runes stay one glyph
+func TestParseCharacters(t *testing.T) {
+	const s = "é👍🏽🇯🇵👩‍👩‍👧日本"
+	glyphs, err := Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"é", "👍🏽", "🇯🇵", "👩‍👩‍👧", "日", "本"}
+	if len(glyphs) != len(want) {
+		t.Fatalf("got %d glyphs %q, want %q", len(glyphs), Plain(glyphs), want)
+	}
+	for i, g := range glyphs {
+		if g.Text != want[i] {
+			t.Errorf("glyph %d is %q, want %q", i, g.Text, want[i])
+		}
+	}
+	if Plain(glyphs) != s {
+		t.Errorf("Plain gave %q", Plain(glyphs))
+	}
+}
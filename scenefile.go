@@ -0,0 +1,270 @@
+package main
+
+import (
+	"ebi/asset"
+	"ebi/collision"
+	"ebi/richtext"
+	"ebi/tiled"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Directory that loadScenes scans for scene definitions and Tiled maps
+const sceneDir = "scenes"
+
+// SceneFile is the on-disk description of a map: which images to draw,
+// where the collisions and doors are and which NPCs live there.
+type SceneFile struct {
+	Name       string        `json:"name"`
+	Extends    string        `json:"extends,omitempty"` // Reuse the collision shapes and props of another scene
+	Background string        `json:"background"`
+	Foreground string        `json:"foreground"`
+	Palette    string        `json:"palette,omitempty"` // Recolours the background and foreground, see assets/palettes.json
+	Obstacles  []RectDef     `json:"obstacles,omitempty"`
+	Diagonals  []DiagonalDef `json:"diagonals,omitempty"`
+	Polygons   []PolygonDef  `json:"polygons,omitempty"`
+	Lines      []LineDef     `json:"lines,omitempty"`
+	Doors      []DoorDef     `json:"doors,omitempty"`
+	Props      []PropDef     `json:"props,omitempty"`
+	NPCs       []NPCDef      `json:"npcs,omitempty"`
+
+	tiledMap *tiled.Map // Set for scenes imported from Tiled, see readTiledSceneFile
+}
+
+// PropDef cuts a part of the foreground, like a tree top or a roof, out into a
+// sprite of its own. It is drawn over characters standing behind it and under
+// the ones in front.
+type PropDef struct {
+	RectDef
+	SortY int `json:"sortY,omitempty"` // Where it meets the ground, the bottom of the rect if left out
+}
+
+type RectDef struct {
+	X1   int    `json:"x1"`
+	Y1   int    `json:"y1"`
+	X2   int    `json:"x2"`
+	Y2   int    `json:"y2"`
+	Note string `json:"note,omitempty"` // Free text for designers, ignored by the game
+}
+
+// DiagonalDef is a staircase of boxes, see AddAirTightDiagonalObstacles
+type DiagonalDef struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	Count  int `json:"count"`
+}
+
+// PolygonDef is a convex collision shape, e.g. a stretch of coastline
+type PolygonDef struct {
+	Points []Vector2D `json:"points"`
+	Note   string     `json:"note,omitempty"`
+}
+
+// LineDef is a thin wall between two points
+type LineDef struct {
+	X1   int    `json:"x1"`
+	Y1   int    `json:"y1"`
+	X2   int    `json:"x2"`
+	Y2   int    `json:"y2"`
+	Note string `json:"note,omitempty"`
+}
+
+type DoorDef struct {
+	Id string `json:"id"`
+	RectDef
+	Destination string   `json:"destination"`
+	Spawn       Vector2D `json:"spawn"` // Player position after walking through the door
+}
+
+type NPCDef struct {
+	Name        string   `json:"name"`
+	DisplayName string   `json:"displayName,omitempty"` // Shown on the dialogue name plate instead of Name, may be a string ID
+	Skin        string   `json:"skin"`                  // Picks the sprite sheets and portraits, e.g. "Blue", see portrait.go
+	Position    Vector2D `json:"position"`
+	Lines       []string `json:"lines,omitempty"` // Said when the NPC has no conversation in the dialogue files
+}
+
+// loadSceneFiles reads every scene definition in dir, keyed by scene name.
+// Tiled maps (.tmx/.tmj) in the same directory are imported as well.
+func loadSceneFiles(assets *asset.Manager, dir string) (map[string]*SceneFile, error) {
+	var paths []string
+	for _, pattern := range []string{"*.json", "*.tmx", "*.tmj"} {
+		matches, err := assets.Glob(path.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, matches...)
+	}
+	sort.Strings(paths)
+
+	defs := make(map[string]*SceneFile)
+	for _, path := range paths {
+		var (
+			def *SceneFile
+			err error
+		)
+		if filepath.Ext(path) == ".json" {
+			def, err = readSceneFile(assets, path)
+		} else {
+			def, err = readTiledSceneFile(assets, path)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := defs[def.Name]; ok {
+			return nil, fmt.Errorf("%s: scene %q is defined twice", path, def.Name)
+		}
+		defs[def.Name] = def
+	}
+	if len(defs) == 0 {
+		return nil, fmt.Errorf("no scene files found in %s", dir)
+	}
+
+	// Pull in the collisions of the scenes we extend
+	resolved := make(map[string]bool)
+	for name := range defs {
+		if err := resolveExtends(defs, name, resolved, map[string]bool{}); err != nil {
+			return nil, err
+		}
+	}
+
+	// Every door has to lead somewhere
+	for _, def := range defs {
+		for _, d := range def.Doors {
+			if _, ok := defs[d.Destination]; !ok {
+				return nil, fmt.Errorf("scene %q: door %q leads to unknown scene %q", def.Name, d.Id, d.Destination)
+			}
+		}
+	}
+	return defs, nil
+}
+
+func readSceneFile(assets *asset.Manager, path string) (*SceneFile, error) {
+	data, err := assets.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var def SceneFile
+	if err := json.Unmarshal(data, &def); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if def.Name == "" {
+		// Fall back to the file name, e.g. scenes/mainMap.json -> mainMap
+		def.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if def.Background == "" || def.Foreground == "" {
+		return nil, fmt.Errorf("%s: background and foreground are required", path)
+	}
+	for i, d := range def.Diagonals {
+		if d.Count <= 0 {
+			return nil, fmt.Errorf("%s: diagonal %d needs a count of at least 1", path, i)
+		}
+	}
+	for i, p := range def.Polygons {
+		if !collision.IsConvex(p.vecs()) {
+			return nil, fmt.Errorf("%s: polygon %d is not convex, split it into convex parts", path, i)
+		}
+	}
+	for i, l := range def.Lines {
+		if l.X1 == l.X2 && l.Y1 == l.Y2 {
+			return nil, fmt.Errorf("%s: line %d starts and ends at the same point", path, i)
+		}
+	}
+	for _, n := range def.NPCs {
+		for _, line := range n.Lines {
+			if _, err := richtext.Parse(line); err != nil {
+				return nil, fmt.Errorf("%s: npc %s: %v", path, n.Name, err)
+			}
+		}
+	}
+	return &def, nil
+}
+
+func resolveExtends(defs map[string]*SceneFile, name string, resolved, visiting map[string]bool) error {
+	if resolved[name] {
+		return nil
+	}
+	if visiting[name] {
+		return fmt.Errorf("scene %q extends itself", name)
+	}
+	visiting[name] = true
+
+	def := defs[name]
+	if def.Extends != "" {
+		base, ok := defs[def.Extends]
+		if !ok {
+			return fmt.Errorf("scene %q extends unknown scene %q", name, def.Extends)
+		}
+		if err := resolveExtends(defs, def.Extends, resolved, visiting); err != nil {
+			return err
+		}
+		def.Obstacles = append(append([]RectDef{}, base.Obstacles...), def.Obstacles...)
+		def.Diagonals = append(append([]DiagonalDef{}, base.Diagonals...), def.Diagonals...)
+		def.Polygons = append(append([]PolygonDef{}, base.Polygons...), def.Polygons...)
+		def.Lines = append(append([]LineDef{}, base.Lines...), def.Lines...)
+		def.Props = append(append([]PropDef{}, base.Props...), def.Props...)
+	}
+	resolved[name] = true
+	return nil
+}
+
+// loadObsnDoors adds the scene's collisions and doors to the current scene.
+func (sf *SceneFile) loadObsnDoors(g *Game) {
+	s := g.Scenes[g.CurrentScene]
+	if s.loaded {
+		return
+	}
+	s.loaded = true
+	for _, o := range sf.Obstacles {
+		g.AddObstacle(o.X1, o.Y1, o.X2, o.Y2)
+	}
+	for _, d := range sf.Diagonals {
+		g.AddAirTightDiagonalObstacles(d.X, d.Y, d.Width, d.Height, d.Count)
+	}
+	for _, p := range sf.Polygons {
+		g.AddPolygonObstacle(p.vecs())
+	}
+	for _, l := range sf.Lines {
+		g.AddLineObstacle(l.X1, l.Y1, l.X2, l.Y2)
+	}
+	for _, d := range sf.Doors {
+		g.AddDoor(d.X1, d.Y1, d.X2, d.Y2, d.Destination, d.Id, d.Spawn.X, d.Spawn.Y)
+	}
+}
+
+// loadNPCs places the scene's NPCs. Unlike obstacles they go into the
+// scene the file describes, so a cutscene can set up a scene before moving
+// there.
+func (sf *SceneFile) loadNPCs(g *Game) {
+	s := g.Scenes[sf.Name]
+	if len(s.NPCs) != 0 {
+		return
+	}
+	for _, n := range sf.NPCs {
+		a, err := loadAnimation(g.assets, g.palettes, n.Skin)
+		if err != nil {
+			// loadScenes has loaded them once already, so this shouldn't happen
+			log.Println(err)
+			continue
+		}
+		cnpc := newNPC(a, n.Name, n.Position.X, n.Position.Y)
+		cnpc.Skin = n.Skin
+		cnpc.DialogueText = n.Lines
+		s.NPCs = append(s.NPCs, cnpc)
+	}
+}
+
+func (p PolygonDef) vecs() []collision.Vec {
+	vs := make([]collision.Vec, len(p.Points))
+	for i, pt := range p.Points {
+		vs[i] = collision.Vec{X: pt.X, Y: pt.Y}
+	}
+	return vs
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"ebi/asset"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestReadSceneFileShapes(t *testing.T) {
+	const head = `{"name": "room", "background": "bg.png", "foreground": "fg.png", `
+	tests := []struct {
+		shapes string
+		err    string // Empty when the scene should load
+	}{
+		{`"diagonals": [{"x": 0, "y": 0, "width": 8, "height": 8, "count": 3}]`, ``},
+		{`"diagonals": [{"x": 0, "y": 0, "width": 8, "height": 8, "count": 0}]`, `diagonal 0 needs a count`},
+		{`"diagonals": [{"x": 0, "y": 0, "width": 8, "height": 8}]`, `diagonal 0 needs a count`},
+		{`"polygons": [{"points": [{"x": 0, "y": 0}, {"x": 8, "y": 0}, {"x": 4, "y": 6}]}]`, ``},
+		{`"polygons": [{"points": [{"x": 0, "y": 0}, {"x": 8, "y": 0}]}]`, `polygon 0 is not convex`},
+		{`"lines": [{"x1": 0, "y1": 0, "x2": 8, "y2": 0}]`, ``},
+		{`"lines": [{"x1": 0, "y1": 0, "x2": 8, "y2": 0}, {"x1": 4, "y1": 4, "x2": 4, "y2": 4}]`, `line 1 starts and ends at the same point`},
+	}
+	for _, tt := range tests {
+		assets := asset.New(fstest.MapFS{"room.json": {Data: []byte(head + tt.shapes + "}")}})
+		_, err := readSceneFile(assets, "room.json")
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: %v", tt.shapes, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: got error %v, want %q", tt.shapes, err, tt.err)
+		}
+	}
+}
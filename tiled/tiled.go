@@ -0,0 +1,180 @@
+// Package tiled reads maps made with the Tiled editor (https://www.mapeditor.org).
+// Both the XML (.tmx) and JSON (.tmj) formats are understood, including
+// external tilesets (.tsx/.tsj). Only orthogonal, finite maps are supported.
+package tiled
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Flags stored in the high bits of a tile GID
+const (
+	FlippedHorizontally uint32 = 0x80000000
+	FlippedVertically   uint32 = 0x40000000
+	FlippedDiagonally   uint32 = 0x20000000
+	RotatedHexagonal    uint32 = 0x10000000
+
+	flipMask = FlippedHorizontally | FlippedVertically | FlippedDiagonally | RotatedHexagonal
+)
+
+type LayerKind int
+
+const (
+	TileLayer LayerKind = iota
+	ObjectLayer
+)
+
+type Map struct {
+	Width, Height         int // Size in tiles
+	TileWidth, TileHeight int
+	Tilesets              []*Tileset
+	Layers                []*Layer
+	Properties            Properties
+}
+
+type Tileset struct {
+	FirstGID              uint32
+	Name                  string
+	TileWidth, TileHeight int
+	TileCount             int
+	Columns               int
+	Spacing, Margin       int
+	Image                 string // Path of the tileset image, in the same file system as the map
+}
+
+type Layer struct {
+	Name             string
+	Kind             LayerKind
+	Visible          bool
+	Opacity          float64
+	OffsetX, OffsetY float64
+	Tiles            []uint32 // Width*Height GIDs for tile layers, row by row
+	Objects          []*Object
+	Properties       Properties
+}
+
+type Object struct {
+	ID                  int
+	Name, Type          string
+	X, Y, Width, Height float64
+	Rotation            float64 // Degrees clockwise around X, Y
+	Ellipse             bool    // Drawn as the ellipse inside its bounds
+	GID                 uint32  // Tile objects only, which are anchored at their bottom left
+	Polygon             []Point // Relative to X, Y
+	Polyline            []Point // Relative to X, Y
+	Properties          Properties
+}
+
+type Point struct {
+	X, Y float64
+}
+
+// Properties holds the custom properties of a map, layer or object as strings.
+type Properties map[string]string
+
+func (p Properties) String(name string) string {
+	return p[name]
+}
+
+func (p Properties) Bool(name string) bool {
+	b, _ := strconv.ParseBool(p[name])
+	return b
+}
+
+func (p Properties) Float(name string) float64 {
+	f, _ := strconv.ParseFloat(p[name], 64)
+	return f
+}
+
+// Load reads a .tmx or .tmj map from disk, relative to the working
+// directory.
+func Load(name string) (*Map, error) {
+	return LoadFS(os.DirFS("."), filepath.ToSlash(name))
+}
+
+// LoadFS reads a .tmx or .tmj map and its tilesets from fsys, such as an
+// embed.FS. Tileset image paths are left as slash separated paths in fsys.
+func LoadFS(fsys fs.FS, name string) (*Map, error) {
+	var (
+		m   *Map
+		err error
+	)
+	switch strings.ToLower(path.Ext(name)) {
+	case ".tmx":
+		m, err = loadTMX(fsys, name)
+	case ".tmj", ".json":
+		m, err = loadTMJ(fsys, name)
+	default:
+		return nil, fmt.Errorf("%s: not a Tiled map", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return m, nil
+}
+
+// Tileset returns the tileset that a GID belongs to, or nil for empty tiles.
+func (m *Map) Tileset(gid uint32) *Tileset {
+	gid &^= flipMask
+	if gid == 0 {
+		return nil
+	}
+	var found *Tileset
+	for _, ts := range m.Tilesets {
+		if ts.FirstGID <= gid && (found == nil || ts.FirstGID > found.FirstGID) {
+			found = ts
+		}
+	}
+	return found
+}
+
+// TileRect returns the pixel rectangle of a tile inside the tileset image.
+func (ts *Tileset) TileRect(gid uint32) (x, y, w, h int) {
+	id := int((gid &^ flipMask) - ts.FirstGID)
+	columns := ts.Columns
+	if columns <= 0 {
+		columns = 1
+	}
+	x = ts.Margin + (id%columns)*(ts.TileWidth+ts.Spacing)
+	y = ts.Margin + (id/columns)*(ts.TileHeight+ts.Spacing)
+	return x, y, ts.TileWidth, ts.TileHeight
+}
+
+func (m *Map) validate() error {
+	if m.Width <= 0 || m.Height <= 0 || m.TileWidth <= 0 || m.TileHeight <= 0 {
+		return fmt.Errorf("invalid map size %dx%d with %dx%d tiles", m.Width, m.Height, m.TileWidth, m.TileHeight)
+	}
+	for _, l := range m.Layers {
+		if l.Kind == TileLayer && len(l.Tiles) != m.Width*m.Height {
+			return fmt.Errorf("layer %q has %d tiles, want %d", l.Name, len(l.Tiles), m.Width*m.Height)
+		}
+	}
+	return nil
+}
+
+// parsePoints reads a TMX "x1,y1 x2,y2" point list
+func parsePoints(s string) ([]Point, error) {
+	var pts []Point
+	for _, pair := range strings.Fields(s) {
+		xs, ys, ok := strings.Cut(pair, ",")
+		if !ok {
+			return nil, fmt.Errorf("bad point %q", pair)
+		}
+		x, err := strconv.ParseFloat(xs, 64)
+		if err != nil {
+			return nil, err
+		}
+		y, err := strconv.ParseFloat(ys, 64)
+		if err != nil {
+			return nil, err
+		}
+		pts = append(pts, Point{x, y})
+	}
+	return pts, nil
+}
@@ -0,0 +1,73 @@
+package tiled
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestObjectShapes(t *testing.T) {
+	fsys := fstest.MapFS{
+		"map.tmx": {Data: []byte(`<map orientation="orthogonal" width="1" height="1" tilewidth="16" tileheight="16">
+ <layer name="ground" width="1" height="1"><data encoding="csv">0</data></layer>
+ <objectgroup name="walls">
+  <object id="1" x="1" y="2" width="8" height="4" rotation="45"/>
+  <object id="2" x="1" y="2" width="8" height="4"><ellipse/></object>
+  <object id="3" x="1" y="2"><polygon points="0,0 4,0 2,3"/></object>
+  <object id="4" gid="2147483649" x="1" y="18" width="16" height="16"/>
+ </objectgroup>
+</map>`)},
+		"map.tmj": {Data: []byte(`{"orientation": "orthogonal", "width": 1, "height": 1, "tilewidth": 16, "tileheight": 16,
+ "layers": [
+  {"type": "tilelayer", "name": "ground", "data": [0]},
+  {"type": "objectgroup", "name": "walls", "objects": [
+   {"id": 1, "x": 1, "y": 2, "width": 8, "height": 4, "rotation": 45},
+   {"id": 2, "x": 1, "y": 2, "width": 8, "height": 4, "ellipse": true},
+   {"id": 3, "x": 1, "y": 2, "polygon": [{"x": 0, "y": 0}, {"x": 4, "y": 0}, {"x": 2, "y": 3}]},
+   {"id": 4, "gid": 2147483649, "x": 1, "y": 18, "width": 16, "height": 16}
+  ]}
+ ]}`)},
+	}
+	want := []Object{
+		{ID: 1, X: 1, Y: 2, Width: 8, Height: 4, Rotation: 45},
+		{ID: 2, X: 1, Y: 2, Width: 8, Height: 4, Ellipse: true},
+		{ID: 3, X: 1, Y: 2, Polygon: []Point{{0, 0}, {4, 0}, {2, 3}}},
+		{ID: 4, X: 1, Y: 18, Width: 16, Height: 16, GID: FlippedHorizontally | 1},
+	}
+	for _, name := range []string{"map.tmx", "map.tmj"} {
+		m, err := LoadFS(fsys, name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		objects := m.Layers[1].Objects
+		if len(objects) != len(want) {
+			t.Fatalf("%s: %d objects, want %d", name, len(objects), len(want))
+		}
+		for i, o := range objects {
+			o.Properties = nil
+			if !reflect.DeepEqual(*o, want[i]) {
+				t.Errorf("%s: object %+v, want %+v", name, *o, want[i])
+			}
+		}
+	}
+}
+
+func TestTileData(t *testing.T) {
+	const csv = "1,2,\n3,2147483652"
+	tiles, err := decodeCSV(csv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []uint32{1, 2, 3, FlippedHorizontally | 4}
+	if !reflect.DeepEqual(tiles, want) {
+		t.Errorf("csv gave %v, want %v", tiles, want)
+	}
+	// The same tiles, little endian, zlib compressed
+	tiles, err = decodeBase64("eJxjZGBgYAJiZiBmYWBoAAAA4ACL", "zlib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tiles, want) {
+		t.Errorf("base64 gave %v, want %v", tiles, want)
+	}
+}
@@ -0,0 +1,234 @@
+package tiled
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+)
+
+type jsonProperty struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+}
+
+type jsonTileset struct {
+	FirstGID   uint32         `json:"firstgid"`
+	Source     string         `json:"source"`
+	Name       string         `json:"name"`
+	TileWidth  int            `json:"tilewidth"`
+	TileHeight int            `json:"tileheight"`
+	TileCount  int            `json:"tilecount"`
+	Columns    int            `json:"columns"`
+	Spacing    int            `json:"spacing"`
+	Margin     int            `json:"margin"`
+	Image      string         `json:"image"`
+	Properties []jsonProperty `json:"properties"`
+}
+
+type jsonObject struct {
+	ID         int            `json:"id"`
+	Name       string         `json:"name"`
+	Type       string         `json:"type"`
+	Class      string         `json:"class"`
+	X          float64        `json:"x"`
+	Y          float64        `json:"y"`
+	Width      float64        `json:"width"`
+	Height     float64        `json:"height"`
+	Rotation   float64        `json:"rotation"`
+	Ellipse    bool           `json:"ellipse"`
+	GID        uint32         `json:"gid"`
+	Polygon    []Point        `json:"polygon"`
+	Polyline   []Point        `json:"polyline"`
+	Properties []jsonProperty `json:"properties"`
+}
+
+type jsonLayer struct {
+	Type        string          `json:"type"`
+	Name        string          `json:"name"`
+	Visible     *bool           `json:"visible"`
+	Opacity     *float64        `json:"opacity"`
+	OffsetX     float64         `json:"offsetx"`
+	OffsetY     float64         `json:"offsety"`
+	Encoding    string          `json:"encoding"`
+	Compression string          `json:"compression"`
+	Data        json.RawMessage `json:"data"`
+	Chunks      json.RawMessage `json:"chunks"`
+	Objects     []jsonObject    `json:"objects"`
+	Layers      []jsonLayer     `json:"layers"`
+	Properties  []jsonProperty  `json:"properties"`
+}
+
+type jsonMap struct {
+	Orientation string         `json:"orientation"`
+	Infinite    bool           `json:"infinite"`
+	Width       int            `json:"width"`
+	Height      int            `json:"height"`
+	TileWidth   int            `json:"tilewidth"`
+	TileHeight  int            `json:"tileheight"`
+	Tilesets    []jsonTileset  `json:"tilesets"`
+	Layers      []jsonLayer    `json:"layers"`
+	Properties  []jsonProperty `json:"properties"`
+}
+
+func loadTMJ(fsys fs.FS, name string) (*Map, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	var jm jsonMap
+	if err := json.Unmarshal(data, &jm); err != nil {
+		return nil, err
+	}
+	if jm.Orientation != "" && jm.Orientation != "orthogonal" {
+		return nil, fmt.Errorf("%s maps are not supported", jm.Orientation)
+	}
+	if jm.Infinite {
+		return nil, fmt.Errorf("infinite maps are not supported")
+	}
+
+	m := &Map{
+		Width:      jm.Width,
+		Height:     jm.Height,
+		TileWidth:  jm.TileWidth,
+		TileHeight: jm.TileHeight,
+		Properties: jsonProperties(jm.Properties),
+	}
+	dir := path.Dir(name)
+	for _, jt := range jm.Tilesets {
+		var ts *Tileset
+		if jt.Source != "" {
+			src := path.Join(dir, jt.Source)
+			if path.Ext(src) == ".tsx" {
+				// A JSON map can still point at an XML tileset
+				ts, err = xmlTilesetFrom(fsys, xmlTileset{Source: jt.Source}, dir)
+			} else {
+				ts, err = loadTSJ(fsys, src)
+			}
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			ts = jsonTilesetFrom(jt, dir)
+		}
+		ts.FirstGID = jt.FirstGID
+		m.Tilesets = append(m.Tilesets, ts)
+	}
+	if err := m.addJSONLayers(jm.Layers, 0, 0, 1, true); err != nil {
+		return nil, err
+	}
+	return m, m.validate()
+}
+
+func loadTSJ(fsys fs.FS, name string) (*Tileset, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	var jt jsonTileset
+	if err := json.Unmarshal(data, &jt); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if jt.Image == "" {
+		return nil, fmt.Errorf("%s: image collection tilesets are not supported", name)
+	}
+	return jsonTilesetFrom(jt, path.Dir(name)), nil
+}
+
+func jsonTilesetFrom(jt jsonTileset, dir string) *Tileset {
+	return &Tileset{
+		FirstGID:   jt.FirstGID,
+		Name:       jt.Name,
+		TileWidth:  jt.TileWidth,
+		TileHeight: jt.TileHeight,
+		TileCount:  jt.TileCount,
+		Columns:    jt.Columns,
+		Spacing:    jt.Spacing,
+		Margin:     jt.Margin,
+		Image:      path.Join(dir, jt.Image),
+	}
+}
+
+func (m *Map) addJSONLayers(layers []jsonLayer, offX, offY, opacity float64, visible bool) error {
+	for _, jl := range layers {
+		l := &Layer{
+			Name:       jl.Name,
+			Visible:    visible && (jl.Visible == nil || *jl.Visible),
+			Opacity:    opacity,
+			OffsetX:    offX + jl.OffsetX,
+			OffsetY:    offY + jl.OffsetY,
+			Properties: jsonProperties(jl.Properties),
+		}
+		if jl.Opacity != nil {
+			l.Opacity *= *jl.Opacity
+		}
+		switch jl.Type {
+		case "group":
+			if err := m.addJSONLayers(jl.Layers, l.OffsetX, l.OffsetY, l.Opacity, l.Visible); err != nil {
+				return err
+			}
+			continue
+		case "tilelayer":
+			if len(jl.Chunks) > 0 {
+				return fmt.Errorf("infinite maps are not supported")
+			}
+			l.Kind = TileLayer
+			tiles, err := decodeJSONData(jl)
+			if err != nil {
+				return fmt.Errorf("layer %q: %v", jl.Name, err)
+			}
+			l.Tiles = tiles
+		case "objectgroup":
+			l.Kind = ObjectLayer
+			for _, jo := range jl.Objects {
+				o := &Object{
+					ID:         jo.ID,
+					Name:       jo.Name,
+					Type:       jo.Type,
+					X:          jo.X,
+					Y:          jo.Y,
+					Width:      jo.Width,
+					Height:     jo.Height,
+					Rotation:   jo.Rotation,
+					Ellipse:    jo.Ellipse,
+					GID:        jo.GID,
+					Polygon:    jo.Polygon,
+					Polyline:   jo.Polyline,
+					Properties: jsonProperties(jo.Properties),
+				}
+				if o.Type == "" {
+					o.Type = jo.Class
+				}
+				l.Objects = append(l.Objects, o)
+			}
+		default:
+			// Image layers are not used by the game
+			continue
+		}
+		m.Layers = append(m.Layers, l)
+	}
+	return nil
+}
+
+func decodeJSONData(jl jsonLayer) ([]uint32, error) {
+	if jl.Encoding == "base64" {
+		var s string
+		if err := json.Unmarshal(jl.Data, &s); err != nil {
+			return nil, err
+		}
+		return decodeBase64(s, jl.Compression)
+	}
+	var tiles []uint32
+	if err := json.Unmarshal(jl.Data, &tiles); err != nil {
+		return nil, err
+	}
+	return tiles, nil
+}
+
+func jsonProperties(props []jsonProperty) Properties {
+	p := make(Properties, len(props))
+	for _, jp := range props {
+		p[jp.Name] = fmt.Sprint(jp.Value)
+	}
+	return p
+}
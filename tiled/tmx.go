@@ -0,0 +1,325 @@
+package tiled
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+)
+
+type xmlProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+	Text  string `xml:",chardata"` // Multi-line values are stored as text
+}
+
+type xmlImage struct {
+	Source string `xml:"source,attr"`
+}
+
+type xmlTileset struct {
+	FirstGID   uint32        `xml:"firstgid,attr"`
+	Source     string        `xml:"source,attr"`
+	Name       string        `xml:"name,attr"`
+	TileWidth  int           `xml:"tilewidth,attr"`
+	TileHeight int           `xml:"tileheight,attr"`
+	TileCount  int           `xml:"tilecount,attr"`
+	Columns    int           `xml:"columns,attr"`
+	Spacing    int           `xml:"spacing,attr"`
+	Margin     int           `xml:"margin,attr"`
+	Image      xmlImage      `xml:"image"`
+	Properties []xmlProperty `xml:"properties>property"`
+}
+
+type xmlData struct {
+	Encoding    string `xml:"encoding,attr"`
+	Compression string `xml:"compression,attr"`
+	Text        string `xml:",chardata"`
+	Tiles       []struct {
+		GID uint32 `xml:"gid,attr"`
+	} `xml:"tile"`
+	Chunks []struct{} `xml:"chunk"`
+}
+
+type xmlObject struct {
+	ID         int           `xml:"id,attr"`
+	Name       string        `xml:"name,attr"`
+	Type       string        `xml:"type,attr"`
+	Class      string        `xml:"class,attr"`
+	X          float64       `xml:"x,attr"`
+	Y          float64       `xml:"y,attr"`
+	Width      float64       `xml:"width,attr"`
+	Height     float64       `xml:"height,attr"`
+	Rotation   float64       `xml:"rotation,attr"`
+	GID        uint32        `xml:"gid,attr"`
+	Properties []xmlProperty `xml:"properties>property"`
+	Ellipse    *struct{}     `xml:"ellipse"`
+	Polygon    *struct {
+		Points string `xml:"points,attr"`
+	} `xml:"polygon"`
+	Polyline *struct {
+		Points string `xml:"points,attr"`
+	} `xml:"polyline"`
+}
+
+// xmlLayer covers <layer>, <objectgroup> and <group>, which share most attributes
+type xmlLayer struct {
+	XMLName    xml.Name
+	Name       string        `xml:"name,attr"`
+	Visible    *int          `xml:"visible,attr"`
+	Opacity    *float64      `xml:"opacity,attr"`
+	OffsetX    float64       `xml:"offsetx,attr"`
+	OffsetY    float64       `xml:"offsety,attr"`
+	Properties []xmlProperty `xml:"properties>property"`
+	Data       xmlData       `xml:"data"`
+	Objects    []xmlObject   `xml:"object"`
+	Layers     []xmlLayer    `xml:",any"`
+}
+
+type xmlMap struct {
+	Orientation string        `xml:"orientation,attr"`
+	Infinite    int           `xml:"infinite,attr"`
+	Width       int           `xml:"width,attr"`
+	Height      int           `xml:"height,attr"`
+	TileWidth   int           `xml:"tilewidth,attr"`
+	TileHeight  int           `xml:"tileheight,attr"`
+	Properties  []xmlProperty `xml:"properties>property"`
+	Tilesets    []xmlTileset  `xml:"tileset"`
+	Layers      []xmlLayer    `xml:",any"`
+}
+
+func loadTMX(fsys fs.FS, name string) (*Map, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	var xm xmlMap
+	if err := xml.Unmarshal(data, &xm); err != nil {
+		return nil, err
+	}
+	if xm.Orientation != "" && xm.Orientation != "orthogonal" {
+		return nil, fmt.Errorf("%s maps are not supported", xm.Orientation)
+	}
+	if xm.Infinite != 0 {
+		return nil, fmt.Errorf("infinite maps are not supported")
+	}
+
+	m := &Map{
+		Width:      xm.Width,
+		Height:     xm.Height,
+		TileWidth:  xm.TileWidth,
+		TileHeight: xm.TileHeight,
+		Properties: xmlProperties(xm.Properties),
+	}
+	dir := path.Dir(name)
+	for _, xt := range xm.Tilesets {
+		ts, err := xmlTilesetFrom(fsys, xt, dir)
+		if err != nil {
+			return nil, err
+		}
+		m.Tilesets = append(m.Tilesets, ts)
+	}
+	if err := m.addXMLLayers(xm.Layers, 0, 0, 1, true); err != nil {
+		return nil, err
+	}
+	return m, m.validate()
+}
+
+// addXMLLayers flattens groups into the map's layer list, in draw order
+func (m *Map) addXMLLayers(layers []xmlLayer, offX, offY, opacity float64, visible bool) error {
+	for _, xl := range layers {
+		kind := xl.XMLName.Local
+		if kind != "layer" && kind != "objectgroup" && kind != "group" {
+			continue
+		}
+		l := &Layer{
+			Name:       xl.Name,
+			Visible:    visible && (xl.Visible == nil || *xl.Visible != 0),
+			Opacity:    opacity,
+			OffsetX:    offX + xl.OffsetX,
+			OffsetY:    offY + xl.OffsetY,
+			Properties: xmlProperties(xl.Properties),
+		}
+		if xl.Opacity != nil {
+			l.Opacity *= *xl.Opacity
+		}
+		switch kind {
+		case "group":
+			if err := m.addXMLLayers(xl.Layers, l.OffsetX, l.OffsetY, l.Opacity, l.Visible); err != nil {
+				return err
+			}
+			continue
+		case "layer":
+			l.Kind = TileLayer
+			tiles, err := decodeXMLData(xl.Data)
+			if err != nil {
+				return fmt.Errorf("layer %q: %v", xl.Name, err)
+			}
+			l.Tiles = tiles
+		case "objectgroup":
+			l.Kind = ObjectLayer
+			for _, xo := range xl.Objects {
+				o := &Object{
+					ID:         xo.ID,
+					Name:       xo.Name,
+					Type:       xo.Type,
+					X:          xo.X,
+					Y:          xo.Y,
+					Width:      xo.Width,
+					Height:     xo.Height,
+					Rotation:   xo.Rotation,
+					Ellipse:    xo.Ellipse != nil,
+					GID:        xo.GID,
+					Properties: xmlProperties(xo.Properties),
+				}
+				if o.Type == "" {
+					o.Type = xo.Class // Tiled 1.9 renamed "type" to "class"
+				}
+				if xo.Polygon != nil {
+					pts, err := parsePoints(xo.Polygon.Points)
+					if err != nil {
+						return fmt.Errorf("object %d: %v", xo.ID, err)
+					}
+					o.Polygon = pts
+				}
+				if xo.Polyline != nil {
+					pts, err := parsePoints(xo.Polyline.Points)
+					if err != nil {
+						return fmt.Errorf("object %d: %v", xo.ID, err)
+					}
+					o.Polyline = pts
+				}
+				l.Objects = append(l.Objects, o)
+			}
+		}
+		m.Layers = append(m.Layers, l)
+	}
+	return nil
+}
+
+func xmlTilesetFrom(fsys fs.FS, xt xmlTileset, dir string) (*Tileset, error) {
+	firstGID := xt.FirstGID
+	if xt.Source != "" {
+		// External tileset, image paths are relative to the .tsx file
+		src := path.Join(dir, xt.Source)
+		if strings.EqualFold(path.Ext(src), ".tsj") || strings.EqualFold(path.Ext(src), ".json") {
+			ts, err := loadTSJ(fsys, src)
+			if err != nil {
+				return nil, err
+			}
+			ts.FirstGID = firstGID
+			return ts, nil
+		}
+		data, err := fs.ReadFile(fsys, src)
+		if err != nil {
+			return nil, err
+		}
+		xt = xmlTileset{}
+		if err := xml.Unmarshal(data, &xt); err != nil {
+			return nil, fmt.Errorf("%s: %v", src, err)
+		}
+		dir = path.Dir(src)
+	}
+	if xt.Image.Source == "" {
+		return nil, fmt.Errorf("tileset %q: image collection tilesets are not supported", xt.Name)
+	}
+	return &Tileset{
+		FirstGID:   firstGID,
+		Name:       xt.Name,
+		TileWidth:  xt.TileWidth,
+		TileHeight: xt.TileHeight,
+		TileCount:  xt.TileCount,
+		Columns:    xt.Columns,
+		Spacing:    xt.Spacing,
+		Margin:     xt.Margin,
+		Image:      path.Join(dir, xt.Image.Source),
+	}, nil
+}
+
+func xmlProperties(props []xmlProperty) Properties {
+	p := make(Properties, len(props))
+	for _, xp := range props {
+		if xp.Value == "" {
+			p[xp.Name] = strings.TrimSpace(xp.Text)
+		} else {
+			p[xp.Name] = xp.Value
+		}
+	}
+	return p
+}
+
+func decodeXMLData(d xmlData) ([]uint32, error) {
+	if len(d.Chunks) > 0 {
+		return nil, fmt.Errorf("infinite maps are not supported")
+	}
+	switch d.Encoding {
+	case "":
+		tiles := make([]uint32, len(d.Tiles))
+		for i, t := range d.Tiles {
+			tiles[i] = t.GID
+		}
+		return tiles, nil
+	case "csv":
+		return decodeCSV(d.Text)
+	case "base64":
+		return decodeBase64(d.Text, d.Compression)
+	}
+	return nil, fmt.Errorf("unknown encoding %q", d.Encoding)
+}
+
+func decodeCSV(s string) ([]uint32, error) {
+	var tiles []uint32
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		gid, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		tiles = append(tiles, uint32(gid))
+	}
+	return tiles, nil
+}
+
+func decodeBase64(s, compression string) ([]uint32, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, err
+	}
+	var r io.Reader = bytes.NewReader(raw)
+	switch compression {
+	case "":
+	case "zlib":
+		if r, err = zlib.NewReader(r); err != nil {
+			return nil, err
+		}
+	case "gzip":
+		if r, err = gzip.NewReader(r); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", compression)
+	}
+	raw, err = io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw)%4 != 0 {
+		return nil, fmt.Errorf("tile data is %d bytes, not a multiple of 4", len(raw))
+	}
+	tiles := make([]uint32, len(raw)/4)
+	for i := range tiles {
+		tiles[i] = binary.LittleEndian.Uint32(raw[i*4:])
+	}
+	return tiles, nil
+}
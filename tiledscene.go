@@ -0,0 +1,256 @@
+package main
+
+import (
+	"ebi/asset"
+	"ebi/collision"
+	"ebi/palette"
+	"ebi/tiled"
+	"fmt"
+	"image"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// readTiledSceneFile builds a scene definition from a Tiled map.
+//
+// Tile layers are drawn into the background, or into the foreground when the
+// layer has a "foreground" bool property. Objects in object layers become:
+//   - obstacles, when they have no type (or "collision"/"obstacle"). Convex
+//     polygons are kept as polygons and polylines become a chain of lines.
+//   - doors, for type "door" with "destination", "spawnX" and "spawnY" properties,
+//     the spawn being where the player appears in the destination map
+//   - NPCs, for type "npc" or "spawn", named after the NPC with optional "skin"
+//     and "displayName" properties
+//   - props, for type "prop", cut out of the foreground with an optional
+//     "sortY" property
+//
+// Any other type is an error, so a misspelled one doesn't drop a wall or
+// door without a word. Shapes are axis aligned, so rotated objects and
+// ellipses are an error rather than the wrong shape. NPCs are points and may
+// be rotated freely.
+// Tile objects count by their bounds, like rectangles.
+//
+// The map itself may set "name", "extends" and "palette" properties like a
+// scene file.
+func readTiledSceneFile(assets *asset.Manager, path string) (*SceneFile, error) {
+	m, err := tiled.LoadFS(assets.FS(), path)
+	if err != nil {
+		return nil, err
+	}
+	def := &SceneFile{
+		Name:     m.Properties.String("name"),
+		Extends:  m.Properties.String("extends"),
+		Palette:  m.Properties.String("palette"),
+		tiledMap: m,
+	}
+	if def.Name == "" {
+		def.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	for _, l := range m.Layers {
+		if l.Kind != tiled.ObjectLayer {
+			continue
+		}
+		for _, o := range l.Objects {
+			kind := strings.ToLower(o.Type)
+			if kind != "npc" && kind != "spawn" {
+				if o.Rotation != 0 {
+					return nil, fmt.Errorf("%s: object %d %q is rotated, which is not supported", path, o.ID, o.Name)
+				}
+				if o.Ellipse {
+					return nil, fmt.Errorf("%s: object %d %q is an ellipse, use a rectangle or polygon", path, o.ID, o.Name)
+				}
+			}
+			rect := tiledObjectRect(o, l)
+			switch kind {
+			case "", "collision", "obstacle":
+				switch {
+				case len(o.Polygon) > 0:
+					p := PolygonDef{Note: o.Name}
+					for _, pt := range o.Polygon {
+						p.Points = append(p.Points, Vector2D{X: o.X + pt.X + l.OffsetX, Y: o.Y + pt.Y + l.OffsetY})
+					}
+					if !collision.IsConvex(p.vecs()) {
+						return nil, fmt.Errorf("%s: polygon %q is not convex, split it into convex parts", path, o.Name)
+					}
+					def.Polygons = append(def.Polygons, p)
+				case len(o.Polyline) > 0:
+					if len(o.Polyline) < 2 {
+						return nil, fmt.Errorf("%s: polyline %q has a single point", path, o.Name)
+					}
+					for i := 1; i < len(o.Polyline); i++ {
+						a, b := o.Polyline[i-1], o.Polyline[i]
+						line := LineDef{
+							X1:   int(math.Round(o.X + a.X + l.OffsetX)),
+							Y1:   int(math.Round(o.Y + a.Y + l.OffsetY)),
+							X2:   int(math.Round(o.X + b.X + l.OffsetX)),
+							Y2:   int(math.Round(o.Y + b.Y + l.OffsetY)),
+							Note: o.Name,
+						}
+						if line.X1 == line.X2 && line.Y1 == line.Y2 {
+							return nil, fmt.Errorf("%s: polyline %q has two points in the same place", path, o.Name)
+						}
+						def.Lines = append(def.Lines, line)
+					}
+				default:
+					def.Obstacles = append(def.Obstacles, rect)
+				}
+			case "door":
+				dest := o.Properties.String("destination")
+				if dest == "" {
+					return nil, fmt.Errorf("%s: door %q has no destination", path, o.Name)
+				}
+				spawnX, err := doorSpawn(o, "spawnX")
+				if err != nil {
+					return nil, fmt.Errorf("%s: %v", path, err)
+				}
+				spawnY, err := doorSpawn(o, "spawnY")
+				if err != nil {
+					return nil, fmt.Errorf("%s: %v", path, err)
+				}
+				def.Doors = append(def.Doors, DoorDef{
+					Id:          o.Name,
+					RectDef:     rect,
+					Destination: dest,
+					Spawn:       Vector2D{X: spawnX, Y: spawnY},
+				})
+			case "prop":
+				def.Props = append(def.Props, PropDef{RectDef: rect, SortY: int(math.Round(o.Properties.Float("sortY")))})
+			case "npc", "spawn":
+				def.NPCs = append(def.NPCs, NPCDef{
+					Name:        o.Name,
+					DisplayName: o.Properties.String("displayName"),
+					Skin:        o.Properties.String("skin"),
+					Position:    Vector2D{X: o.X + l.OffsetX, Y: o.Y + l.OffsetY},
+				})
+			default:
+				return nil, fmt.Errorf("%s: object %d %q has unknown type %q", path, o.ID, o.Name, o.Type)
+			}
+		}
+	}
+	return def, nil
+}
+
+// doorSpawn reads one coordinate of where a door puts the player, which
+// unlike other properties must be set
+func doorSpawn(o *tiled.Object, name string) (float64, error) {
+	s, ok := o.Properties[name]
+	if !ok {
+		return 0, fmt.Errorf("door %q has no %s", o.Name, name)
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("door %q: %s %q is not a number", o.Name, name, s)
+	}
+	return f, nil
+}
+
+// tiledObjectRect returns the bounds of an object, polygons included
+func tiledObjectRect(o *tiled.Object, l *tiled.Layer) RectDef {
+	x1, y1 := o.X, o.Y
+	if o.GID != 0 {
+		// Tile objects hang up from their position
+		y1 = o.Y - o.Height
+	}
+	x2, y2 := x1+o.Width, y1+o.Height
+	if len(o.Polygon) > 0 {
+		x1, y1, x2, y2 = math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+		for _, p := range o.Polygon {
+			x1 = math.Min(x1, o.X+p.X)
+			y1 = math.Min(y1, o.Y+p.Y)
+			x2 = math.Max(x2, o.X+p.X)
+			y2 = math.Max(y2, o.Y+p.Y)
+		}
+	}
+	return RectDef{
+		X1:   int(math.Round(x1 + l.OffsetX)),
+		Y1:   int(math.Round(y1 + l.OffsetY)),
+		X2:   int(math.Round(x2 + l.OffsetX)),
+		Y2:   int(math.Round(y2 + l.OffsetY)),
+		Note: o.Name,
+	}
+}
+
+// renderTiledMap draws the tile layers of a map into a background and a
+// foreground image the size of the whole map.
+func renderTiledMap(assets *asset.Manager, pal *palette.Palette, m *tiled.Map) (*ebiten.Image, *ebiten.Image, error) {
+	w, h := m.Width*m.TileWidth, m.Height*m.TileHeight
+	bg := ebiten.NewImage(w, h)
+	fg := ebiten.NewImage(w, h)
+
+	tilesets := make(map[*tiled.Tileset]*ebiten.Image)
+	for _, ts := range m.Tilesets {
+		img, err := assets.Recolored(ts.Image, pal)
+		if err != nil {
+			return nil, nil, fmt.Errorf("tileset %q: %v", ts.Name, err)
+		}
+		tilesets[ts] = img
+	}
+
+	for _, l := range m.Layers {
+		if l.Kind != tiled.TileLayer || !l.Visible {
+			continue
+		}
+		dst := bg
+		if l.Properties.Bool("foreground") {
+			dst = fg
+		}
+		for i, gid := range l.Tiles {
+			ts := m.Tileset(gid)
+			if ts == nil {
+				continue
+			}
+			sx, sy, tw, th := ts.TileRect(gid)
+			tile := tilesets[ts].SubImage(image.Rect(sx, sy, sx+tw, sy+th)).(*ebiten.Image)
+
+			opts := &ebiten.DrawImageOptions{}
+			opts.GeoM = tileFlip(gid, tw, th)
+			// Tiles taller than the grid are anchored to the bottom of their cell
+			_, h := flippedSize(gid, tw, th)
+			col, row := i%m.Width, i/m.Width
+			opts.GeoM.Translate(
+				float64(col*m.TileWidth)+l.OffsetX,
+				float64((row+1)*m.TileHeight-h)+l.OffsetY,
+			)
+			opts.ColorScale.ScaleAlpha(float32(l.Opacity))
+			dst.DrawImage(tile, opts)
+		}
+	}
+	return bg, fg, nil
+}
+
+// flippedSize returns the size of a tile as drawn, which is turned on its
+// side when it's flipped diagonally
+func flippedSize(gid uint32, tw, th int) (w, h int) {
+	if gid&tiled.FlippedDiagonally != 0 {
+		return th, tw
+	}
+	return tw, th
+}
+
+// tileFlip returns the transform for the flip flags of a GID, keeping the
+// flipped tile's top left at 0, 0. Like Tiled, the diagonal flip swapping x
+// and y comes first, so the other flips work on the swapped size.
+func tileFlip(gid uint32, tw, th int) ebiten.GeoM {
+	var m ebiten.GeoM
+	if gid&tiled.FlippedDiagonally != 0 {
+		m.SetElement(0, 0, 0)
+		m.SetElement(0, 1, 1)
+		m.SetElement(1, 0, 1)
+		m.SetElement(1, 1, 0)
+	}
+	w, h := flippedSize(gid, tw, th)
+	if gid&tiled.FlippedHorizontally != 0 {
+		m.Scale(-1, 1)
+		m.Translate(float64(w), 0)
+	}
+	if gid&tiled.FlippedVertically != 0 {
+		m.Scale(1, -1)
+		m.Translate(0, float64(h))
+	}
+	return m
+}
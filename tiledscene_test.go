@@ -0,0 +1,145 @@
+package main
+
+import (
+	"ebi/asset"
+	"ebi/tiled"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// Both fixtures describe the same room, once as TMX and once as TMJ
+func TestReadTiledSceneFile(t *testing.T) {
+	assets := asset.Disk("testdata/tiled")
+	for _, path := range []string{"room.tmx", "room.tmj"} {
+		t.Run(path, func(t *testing.T) {
+			def, err := readTiledSceneFile(assets, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if def.Name != "room" || def.Palette != "Green" {
+				t.Errorf("name %q palette %q, want room and Green", def.Name, def.Palette)
+			}
+
+			// The walls layer is offset by 2, 1
+			wantObstacles := []RectDef{{X1: 10, Y1: 11, X2: 30, Y2: 17, Note: "table"}}
+			if !reflect.DeepEqual(def.Obstacles, wantObstacles) {
+				t.Errorf("obstacles %+v, want %+v", def.Obstacles, wantObstacles)
+			}
+			wantPolygons := []PolygonDef{{Points: []Vector2D{{42, 1}, {52, 1}, {47, 9}}, Note: "rock"}}
+			if !reflect.DeepEqual(def.Polygons, wantPolygons) {
+				t.Errorf("polygons %+v, want %+v", def.Polygons, wantPolygons)
+			}
+			wantLines := []LineDef{
+				{X1: 2, Y1: 41, X2: 18, Y2: 41, Note: "fence"},
+				{X1: 18, Y1: 41, X2: 18, Y2: 33, Note: "fence"},
+			}
+			if !reflect.DeepEqual(def.Lines, wantLines) {
+				t.Errorf("lines %+v, want %+v", def.Lines, wantLines)
+			}
+
+			wantDoors := []DoorDef{{
+				Id:          "toTown",
+				RectDef:     RectDef{X1: 48, Y1: 32, X2: 64, Y2: 48, Note: "toTown"},
+				Destination: "mainMap",
+				Spawn:       Vector2D{120, 64.5},
+			}}
+			if !reflect.DeepEqual(def.Doors, wantDoors) {
+				t.Errorf("doors %+v, want %+v", def.Doors, wantDoors)
+			}
+			wantNPCs := []NPCDef{{Name: "bryan", DisplayName: "npc.bryan", Skin: "Blue", Position: Vector2D{24, 20}}}
+			if !reflect.DeepEqual(def.NPCs, wantNPCs) {
+				t.Errorf("NPCs %+v, want %+v", def.NPCs, wantNPCs)
+			}
+
+			wantProps := []PropDef{{RectDef: RectDef{X1: 4, Y1: 0, X2: 12, Y2: 12, Note: "lamp"}, SortY: 30}}
+			if !reflect.DeepEqual(def.Props, wantProps) {
+				t.Errorf("props %+v, want %+v", def.Props, wantProps)
+			}
+
+			tiles := def.tiledMap.Layers[0].Tiles
+			if len(tiles) != 12 || tiles[9] != tiled.FlippedHorizontally|2 || tiles[11] != tiled.FlippedDiagonally|1 {
+				t.Errorf("tiles %v", tiles)
+			}
+		})
+	}
+}
+
+func TestReadTiledSceneFileObjects(t *testing.T) {
+	const head = `<map orientation="orthogonal" width="1" height="1" tilewidth="16" tileheight="16">
+ <layer name="ground" width="1" height="1"><data encoding="csv">0</data></layer>
+ <objectgroup name="walls">`
+	const tail = `</objectgroup></map>`
+	tests := []struct {
+		object    string
+		err       string    // Empty when the map should load
+		obstacles []RectDef // Checked when the map loads
+	}{
+		{object: `<object id="1" name="crate" x="0" y="0" width="8" height="8" rotation="45"/>`, err: `object 1 "crate" is rotated`},
+		{object: `<object id="2" name="door" type="door" x="0" y="0" width="8" height="8" rotation="90"/>`, err: `object 2 "door" is rotated`},
+		{object: `<object id="3" name="pond" x="0" y="0" width="8" height="8"><ellipse/></object>`, err: `object 3 "pond" is an ellipse`},
+		{object: `<object id="4" name="bryan" type="npc" x="4" y="4" rotation="30"><point/></object>`},
+		{
+			object: `<object id="5" name="exit" type="door" x="0" y="0" width="8" height="8"><properties>
+  <property name="destination" value="mainMap"/><property name="spawnX" value="4"/>
+ </properties></object>`,
+			err: `door "exit" has no spawnY`,
+		},
+		{
+			object: `<object id="6" name="exit" type="door" x="0" y="0" width="8" height="8"><properties>
+  <property name="destination" value="mainMap"/><property name="spawnX" value="left"/><property name="spawnY" value="4"/>
+ </properties></object>`,
+			err: `door "exit": spawnX "left" is not a number`,
+		},
+		{object: `<object id="8" name="wall" x="0" y="0"><polyline points="0,0 8,0 8,0.2"/></object>`, err: `polyline "wall" has two points in the same place`},
+		{object: `<object id="9" name="rock" x="0" y="0"><polygon points="0,0 8,0 16,0"/></object>`, err: `polygon "rock" is not convex`},
+		{object: `<object id="10" name="exit" type="dor" x="0" y="0" width="8" height="8"/>`, err: `object 10 "exit" has unknown type "dor"`},
+		// Tile objects are placed by their bottom left corner
+		{
+			object:    `<object id="7" name="barrel" gid="1" x="8" y="16" width="8" height="10"/>`,
+			obstacles: []RectDef{{X1: 8, Y1: 6, X2: 16, Y2: 16, Note: "barrel"}},
+		},
+	}
+	for _, tt := range tests {
+		assets := asset.New(fstest.MapFS{"map.tmx": {Data: []byte(head + tt.object + tail)}})
+		def, err := readTiledSceneFile(assets, "map.tmx")
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: %v", tt.object, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: got error %v, want %q", tt.object, err, tt.err)
+		case err == nil && !reflect.DeepEqual(def.Obstacles, tt.obstacles):
+			t.Errorf("%s: obstacles %+v, want %+v", tt.object, def.Obstacles, tt.obstacles)
+		}
+	}
+}
+
+// Flipped tiles must land on the same spot as the unflipped tile, turned on
+// their side when flipped diagonally, even when they are not square
+func TestTileFlip(t *testing.T) {
+	const tw, th = 16, 32
+	for flags := uint32(0); flags < 8; flags++ {
+		gid := flags<<29 | 1
+		geo := tileFlip(gid, tw, th)
+		w, h := flippedSize(gid, tw, th)
+		minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+		for _, c := range [][2]float64{{0, 0}, {tw, 0}, {0, th}, {tw, th}} {
+			x, y := geo.Apply(c[0], c[1])
+			minX, minY = math.Min(minX, x), math.Min(minY, y)
+			maxX, maxY = math.Max(maxX, x), math.Max(maxY, y)
+		}
+		if minX != 0 || minY != 0 || maxX != float64(w) || maxY != float64(h) {
+			t.Errorf("flags %03b: tile covers %v,%v to %v,%v, want 0,0 to %d,%d", flags, minX, minY, maxX, maxY, w, h)
+		}
+	}
+
+	// Diagonal and horizontal is a quarter turn clockwise, so the top left
+	// corner ends up top right
+	geo := tileFlip(tiled.FlippedDiagonally|tiled.FlippedHorizontally|1, tw, th)
+	x, y := geo.Apply(0, 0)
+	if x != th || y != 0 {
+		t.Errorf("top left corner at %v,%v, want %d,0", x, y, th)
+	}
+}